@@ -11,6 +11,7 @@ import (
 type Node interface {
 	TokenLiteral() string // Only for debugging and testing
 	String() string       // Print AST nodes for debugging
+	Pos() token.Position  // Where the node starts in the source, used for error messages
 }
 
 // Nodes implementing the Node interface have to provide the TokenLiteral() method
@@ -30,6 +31,13 @@ type Program struct {
 	Statements []Statement
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) <= 0 {
+		return token.Position{}
+	}
+	return p.Statements[0].Pos()
+}
+
 func (p *Program) TokenLiteral() string {
 	if len(p.Statements) <= 0 {
 		return ""
@@ -59,6 +67,7 @@ type Identifier struct {
 func (i *Identifier) expressionNode() {}
 
 // As Identifier aims to satisfy the Expression interface, it also needs to satisfy the Node interface
+func (i *Identifier) Pos() token.Position  { return i.Token.Pos }
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
 
 func (i *Identifier) String() string { return i.Value }
@@ -96,18 +105,25 @@ func (i *Identifier) String() string { return i.Value }
 type LetStatement struct {
 	Token token.Token // the token.LET
 	Name  *Identifier // the identifier holding the variable name
-	Value Expression  // the expression producing the value
+	// Takes the value apart instead of binding it to Name, e.g. let (q, r) = divmod(7, 2)
+	Pattern Pattern
+	Value   Expression // the expression producing the value
 }
 
 func (ls *LetStatement) statementNode() {}
 
+func (ls *LetStatement) Pos() token.Position  { return ls.Token.Pos }
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
 
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
 	out.WriteString(ls.TokenLiteral() + " ")
-	out.WriteString(ls.Name.String())
+	if ls.Pattern != nil {
+		out.WriteString(ls.Pattern.String())
+	} else {
+		out.WriteString(ls.Name.String())
+	}
 	out.WriteString(" = ")
 
 	if ls.Value != nil {
@@ -126,6 +142,7 @@ type ReturnStatement struct {
 
 func (rs *ReturnStatement) statementNode() {}
 
+func (rs *ReturnStatement) Pos() token.Position  { return rs.Token.Pos }
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
 
 func (rs *ReturnStatement) String() string {
@@ -157,6 +174,8 @@ type ForStatement struct {
 
 func (fs *ForStatement) statementNode() {}
 
+func (fs *ForStatement) Pos() token.Position { return fs.Token.Pos }
+
 func (fs *ForStatement) TokenLiteral() string {
 	return fs.Token.Literal
 }
@@ -186,6 +205,8 @@ type WhileStatement struct {
 
 func (ws *WhileStatement) statementNode() {}
 
+func (ws *WhileStatement) Pos() token.Position { return ws.Token.Pos }
+
 func (ws *WhileStatement) TokenLiteral() string {
 	return ws.Token.Literal
 }
@@ -208,6 +229,8 @@ type BreakStatement struct {
 
 func (bs *BreakStatement) statementNode() {}
 
+func (bs *BreakStatement) Pos() token.Position { return bs.Token.Pos }
+
 func (bs *BreakStatement) TokenLiteral() string {
 	return bs.Token.Literal
 }
@@ -226,6 +249,8 @@ type ContinueStatement struct {
 
 func (cs *ContinueStatement) statementNode() {}
 
+func (cs *ContinueStatement) Pos() token.Position { return cs.Token.Pos }
+
 func (cs *ContinueStatement) TokenLiteral() string {
 	return cs.Token.Literal
 }
@@ -245,6 +270,7 @@ type ExpressionStatement struct {
 
 func (es *ExpressionStatement) statementNode() {} // fulfill the ast.Statement interface so we can add this to the Statements[] slice
 
+func (es ExpressionStatement) Pos() token.Position  { return es.Token.Pos }
 func (es ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
 
 func (es *ExpressionStatement) String() string {
@@ -262,6 +288,7 @@ type IntegerLiteral struct {
 
 func (il *IntegerLiteral) expressionNode() {}
 
+func (il *IntegerLiteral) Pos() token.Position  { return il.Token.Pos }
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
 
 func (il *IntegerLiteral) String() string { return il.Token.Literal }
@@ -273,6 +300,7 @@ type FloatLiteral struct {
 
 func (fl *FloatLiteral) expressionNode() {}
 
+func (fl *FloatLiteral) Pos() token.Position  { return fl.Token.Pos }
 func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
 
 func (fl *FloatLiteral) String() string { return fl.Token.Literal }
@@ -317,6 +345,7 @@ type PrefixExpression struct {
 
 func (pe *PrefixExpression) expressionNode() {}
 
+func (pe *PrefixExpression) Pos() token.Position  { return pe.Token.Pos }
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
 
 // Wrap the expression inside parentheses to make operator precedence explicit
@@ -342,6 +371,7 @@ type InfixExpression struct {
 
 func (ie *InfixExpression) expressionNode() {}
 
+func (ie *InfixExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
 
 // Wraide parentheses to make operator precedence explicit
@@ -367,6 +397,7 @@ type PostfixExpression struct {
 
 func (pe *PostfixExpression) expressionNode() {}
 
+func (pe *PostfixExpression) Pos() token.Position  { return pe.Token.Pos }
 func (pe *PostfixExpression) TokenLiteral() string { return pe.Token.Literal }
 
 func (pe *PostfixExpression) String() string {
@@ -387,6 +418,7 @@ type Boolean struct {
 
 func (b *Boolean) expressionNode() {}
 
+func (b *Boolean) Pos() token.Position  { return b.Token.Pos }
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
 
 func (b *Boolean) String() string { return b.Token.Literal }
@@ -400,6 +432,7 @@ type IfExpression struct {
 
 func (ie *IfExpression) expressionNode() {}
 
+func (ie *IfExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
 
 func (ie *IfExpression) String() string {
@@ -418,6 +451,34 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// try { ... } catch (e) { ... }
+// Evaluates to the value of the try block, or of the catch block
+// if the try block raised an error
+type TryExpression struct {
+	Token   token.Token // The 'try' token
+	Block   *BlockStatement
+	Param   *Identifier // Bound to the caught error
+	Handler *BlockStatement
+}
+
+func (te *TryExpression) expressionNode() {}
+
+func (te *TryExpression) Pos() token.Position  { return te.Token.Pos }
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(te.Block.String())
+	out.WriteString("catch(")
+	out.WriteString(te.Param.String())
+	out.WriteString(") ")
+	out.WriteString(te.Handler.String())
+
+	return out.String()
+}
+
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
@@ -425,6 +486,7 @@ type BlockStatement struct {
 
 func (bs *BlockStatement) expressionNode() {}
 
+func (bs *BlockStatement) Pos() token.Position  { return bs.Token.Pos }
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
 
 func (bs *BlockStatement) String() string {
@@ -440,12 +502,21 @@ func (bs *BlockStatement) String() string {
 type FunctionLiteral struct {
 	Token      token.Token // The 'funk' token
 	Parameters []*Identifier
-	Body       *BlockStatement
-	Name       string
+	// The default values of the parameters, e.g. 2 in funk(a, b = 2), nil for those without one.
+	// Only trailing parameters have defaults, and the slice is nil if none has
+	Defaults []Expression
+	// Collects the arguments after the parameters into an array, e.g. ...rest
+	Rest *Identifier
+	// The patterns the arguments are taken apart with, e.g. [a, b] in funk([a, b]), nil for plain parameters.
+	// Their parameters are named after them, and the slice is nil if there are none
+	Patterns []Pattern
+	Body     *BlockStatement
+	Name     string
 }
 
 func (fl *FunctionLiteral) expressionNode() {}
 
+func (fl *FunctionLiteral) Pos() token.Position  { return fl.Token.Pos }
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
 
 func (fl *FunctionLiteral) String() string {
@@ -458,20 +529,31 @@ func (fl *FunctionLiteral) String() string {
 		out.WriteString(fmt.Sprintf("<%s>", fl.Name))
 	}
 	out.WriteString("(")
-
-	for i, param := range fl.Parameters {
-		if i > 0 {
-			out.WriteString(", ")
-		}
-
-		out.WriteString(param.String())
-	}
+	out.WriteString(ParametersString(fl.Parameters, fl.Defaults, fl.Rest))
 
 	out.WriteString(") ")
 	out.WriteString(fl.Body.String())
 	return out.String()
 }
 
+// Format a parameter list the way it is written, without the parentheses
+func ParametersString(params []*Identifier, defaults []Expression, rest *Identifier) string {
+	var out []string
+
+	for i, param := range params {
+		if i < len(defaults) && defaults[i] != nil {
+			out = append(out, param.String()+" = "+defaults[i].String())
+		} else {
+			out = append(out, param.String())
+		}
+	}
+	if rest != nil {
+		out = append(out, "..."+rest.String())
+	}
+
+	return strings.Join(out, ", ")
+}
+
 type CallExpression struct {
 	Token     token.Token // The L.PAREN token
 	Function  Expression  // Function identifiers are expressions too. Plus, this could either be an identifier or a function literal
@@ -480,6 +562,7 @@ type CallExpression struct {
 
 func (ce *CallExpression) expressionNode() {}
 
+func (ce *CallExpression) Pos() token.Position  { return ce.Token.Pos }
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
 
 func (ce *CallExpression) String() string {
@@ -506,6 +589,7 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) expressionNode() {}
 
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Pos }
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
 
 func (sl *StringLiteral) String() string { return sl.Token.Literal }
@@ -517,6 +601,7 @@ type ArrayLiteral struct {
 
 func (al *ArrayLiteral) expressionNode() {}
 
+func (al *ArrayLiteral) Pos() token.Position  { return al.Token.Pos }
 func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
 
 func (al *ArrayLiteral) String() string {
@@ -544,6 +629,7 @@ type TernaryExpression struct {
 
 func (te *TernaryExpression) expressionNode() {}
 
+func (te *TernaryExpression) Pos() token.Position  { return te.Token.Pos }
 func (te *TernaryExpression) TokenLiteral() string { return te.Token.Literal }
 
 func (te *TernaryExpression) String() string {
@@ -568,6 +654,7 @@ type IndexExpression struct {
 
 func (ie *IndexExpression) expressionNode() {}
 
+func (ie *IndexExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
 
 func (ie *IndexExpression) String() string {
@@ -586,12 +673,15 @@ func (ie *IndexExpression) String() string {
 type Assignment struct {
 	Token token.Token
 	Name  Expression
-	Value Expression
+	// The operator of a compound assignment, e.g. + in x += 1, empty for a plain =
+	Operator string
+	Value    Expression
 }
 
 // Assignment can be both Statement and Expression?
 func (a *Assignment) expressionNode() {}
 
+func (a *Assignment) Pos() token.Position  { return a.Token.Pos }
 func (a *Assignment) TokenLiteral() string { return a.Token.Literal }
 
 func (a *Assignment) String() string {
@@ -599,7 +689,7 @@ func (a *Assignment) String() string {
 
 	out.WriteString("(")
 	out.WriteString(a.Name.String())
-	out.WriteString(" = ")
+	out.WriteString(" " + a.Operator + "= ")
 	out.WriteString(a.Value.String())
 	out.WriteString(")")
 
@@ -613,6 +703,7 @@ type HashLiteral struct {
 
 func (hl *HashLiteral) expressionNode() {}
 
+func (hl *HashLiteral) Pos() token.Position  { return hl.Token.Pos }
 func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
 
 func (hl *HashLiteral) String() string {
@@ -639,6 +730,7 @@ type MacroLiteral struct {
 
 func (ml *MacroLiteral) expressionNode() {}
 
+func (ml *MacroLiteral) Pos() token.Position  { return ml.Token.Pos }
 func (ml *MacroLiteral) TokenLiteral() string { return ml.Token.Literal }
 
 func (ml *MacroLiteral) String() string {
@@ -657,3 +749,174 @@ func (ml *MacroLiteral) String() string {
 
 	return out.String()
 }
+
+// Declares a struct type and binds it to a name, e.g. struct Point { x, y }
+type StructStatement struct {
+	Token  token.Token // the token.STRUCT
+	Name   *Identifier
+	Fields []*Identifier
+}
+
+func (ss *StructStatement) statementNode() {}
+
+func (ss *StructStatement) Pos() token.Position  { return ss.Token.Pos }
+func (ss *StructStatement) TokenLiteral() string { return ss.Token.Literal }
+
+func (ss *StructStatement) String() string {
+	var out bytes.Buffer
+
+	fields := []string{}
+	for _, f := range ss.Fields {
+		fields = append(fields, f.String())
+	}
+
+	out.WriteString(ss.TokenLiteral() + " ")
+	out.WriteString(ss.Name.String())
+	out.WriteString(" { ")
+	out.WriteString(strings.Join(fields, ", "))
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+// Creates a struct, e.g. Point { x: 1, y: 2 }.
+// Fields and Values are in the order they are written in
+type StructLiteral struct {
+	Token  token.Token // the { token
+	Type   Expression  // evaluates to the struct type
+	Fields []*Identifier
+	Values []Expression
+}
+
+func (sl *StructLiteral) expressionNode() {}
+
+func (sl *StructLiteral) Pos() token.Position  { return sl.Token.Pos }
+func (sl *StructLiteral) TokenLiteral() string { return sl.Token.Literal }
+
+func (sl *StructLiteral) String() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for i, f := range sl.Fields {
+		pairs = append(pairs, f.String()+": "+sl.Values[i].String())
+	}
+
+	out.WriteString(sl.Type.String())
+	out.WriteString(" { ")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+// Reads a field of a struct, e.g. point.x
+type FieldExpression struct {
+	Token  token.Token // the token.DOT
+	Object Expression
+	Field  *Identifier
+}
+
+func (fe *FieldExpression) expressionNode() {}
+
+func (fe *FieldExpression) Pos() token.Position  { return fe.Token.Pos }
+func (fe *FieldExpression) TokenLiteral() string { return fe.Token.Literal }
+
+func (fe *FieldExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(fe.Object.String())
+	out.WriteString(".")
+	out.WriteString(fe.Field.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// An immutable list of values, e.g. (1, "a", true).
+// A tuple with one element is written with a trailing comma, (1,), to tell it apart from a grouped expression
+type TupleLiteral struct {
+	Token    token.Token // the ( token, or the return token of return a, b
+	Elements []Expression
+}
+
+func (tl *TupleLiteral) expressionNode() {}
+
+func (tl *TupleLiteral) Pos() token.Position  { return tl.Token.Pos }
+func (tl *TupleLiteral) TokenLiteral() string { return tl.Token.Literal }
+
+func (tl *TupleLiteral) String() string {
+	elements := []string{}
+	for _, el := range tl.Elements {
+		elements = append(elements, el.String())
+	}
+	if len(elements) == 1 {
+		return "(" + elements[0] + ",)"
+	}
+	return "(" + strings.Join(elements, ", ") + ")"
+}
+
+// The shape of a value to take apart and the names to bind its parts to,
+// on the left of a let statement or in place of a parameter
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+// Binds the elements of a tuple, e.g. the (q, r) in let (q, r) = divmod(7, 2)
+type TuplePattern struct {
+	Token token.Token // the ( token
+	Names []*Identifier
+}
+
+func (tp *TuplePattern) patternNode() {}
+
+func (tp *TuplePattern) Pos() token.Position  { return tp.Token.Pos }
+func (tp *TuplePattern) TokenLiteral() string { return tp.Token.Literal }
+
+func (tp *TuplePattern) String() string {
+	return "(" + namesString(tp.Names, nil) + ")"
+}
+
+// Binds the elements of an array, e.g. [a, b, ...rest]
+type ArrayPattern struct {
+	Token token.Token // the [ token
+	Names []*Identifier
+	// Collects the elements after the names into an array
+	Rest *Identifier
+}
+
+func (ap *ArrayPattern) patternNode() {}
+
+func (ap *ArrayPattern) Pos() token.Position  { return ap.Token.Pos }
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Literal }
+
+func (ap *ArrayPattern) String() string {
+	return "[" + namesString(ap.Names, ap.Rest) + "]"
+}
+
+// Binds the values of a hash to the names of their string keys, e.g. {name, age}
+type HashPattern struct {
+	Token token.Token // the { token
+	Names []*Identifier
+}
+
+func (hp *HashPattern) patternNode() {}
+
+func (hp *HashPattern) Pos() token.Position  { return hp.Token.Pos }
+func (hp *HashPattern) TokenLiteral() string { return hp.Token.Literal }
+
+func (hp *HashPattern) String() string {
+	return "{" + namesString(hp.Names, nil) + "}"
+}
+
+func namesString(names []*Identifier, rest *Identifier) string {
+	out := []string{}
+	for _, name := range names {
+		out = append(out, name.String())
+	}
+	if rest != nil {
+		out = append(out, "..."+rest.String())
+	}
+	return strings.Join(out, ", ")
+}
@@ -0,0 +1,232 @@
+package ast
+
+// Return a deep copy of node, so the copy can be handed to Modify
+// without changing the original tree (e.g., the body of a macro that is expanded more than once)
+func Copy(node Node) Node {
+	switch node := node.(type) {
+	case *Program:
+		c := *node
+		c.Statements = copyStatements(node.Statements)
+		return &c
+	case *ExpressionStatement:
+		c := *node
+		c.Expression = copyExpression(node.Expression)
+		return &c
+	case *InfixExpression:
+		c := *node
+		c.Left = copyExpression(node.Left)
+		c.Right = copyExpression(node.Right)
+		return &c
+	case *PrefixExpression:
+		c := *node
+		c.Right = copyExpression(node.Right)
+		return &c
+	case *PostfixExpression:
+		c := *node
+		c.Left = copyExpression(node.Left)
+		return &c
+	case *IndexExpression:
+		c := *node
+		c.Left = copyExpression(node.Left)
+		c.Index = copyExpression(node.Index)
+		return &c
+	case *IfExpression:
+		c := *node
+		c.Condition = copyExpression(node.Condition)
+		c.Consequence = copyBlock(node.Consequence)
+		c.Alternative = copyBlock(node.Alternative)
+		return &c
+	case *TryExpression:
+		c := *node
+		c.Block = copyBlock(node.Block)
+		c.Param = copyIdentifier(node.Param)
+		c.Handler = copyBlock(node.Handler)
+		return &c
+	case *BlockStatement:
+		return copyBlock(node)
+	case *ReturnStatement:
+		c := *node
+		c.ReturnValue = copyExpression(node.ReturnValue)
+		return &c
+	case *LetStatement:
+		c := *node
+		c.Name = copyIdentifier(node.Name)
+		c.Pattern = copyPattern(node.Pattern)
+		c.Value = copyExpression(node.Value)
+		return &c
+	case *FunctionLiteral:
+		c := *node
+		c.Parameters = copyIdentifiers(node.Parameters)
+		c.Defaults = copyExpressions(node.Defaults)
+		c.Rest = copyIdentifier(node.Rest)
+		if node.Patterns != nil {
+			c.Patterns = make([]Pattern, len(node.Patterns))
+			for i, pattern := range node.Patterns {
+				c.Patterns[i] = copyPattern(pattern)
+			}
+		}
+		c.Body = copyBlock(node.Body)
+		return &c
+	case *MacroLiteral:
+		c := *node
+		c.Parameters = copyIdentifiers(node.Parameters)
+		c.Body = copyBlock(node.Body)
+		return &c
+	case *CallExpression:
+		c := *node
+		c.Function = copyExpression(node.Function)
+		c.Arguments = copyExpressions(node.Arguments)
+		return &c
+	case *TernaryExpression:
+		c := *node
+		c.Condition = copyExpression(node.Condition)
+		c.Consequence = copyExpression(node.Consequence)
+		c.Alternative = copyExpression(node.Alternative)
+		return &c
+	case *Assignment:
+		c := *node
+		c.Name = copyExpression(node.Name)
+		c.Value = copyExpression(node.Value)
+		return &c
+	case *WhileStatement:
+		c := *node
+		c.Condition = copyExpression(node.Condition)
+		c.Body = copyBlock(node.Body)
+		return &c
+	case *ForStatement:
+		c := *node
+		if node.Init != nil {
+			c.Init, _ = Copy(node.Init).(*LetStatement)
+		}
+		c.Condition = copyExpression(node.Condition)
+		c.Update = copyExpression(node.Update)
+		c.Body = copyBlock(node.Body)
+		return &c
+	case *ArrayLiteral:
+		c := *node
+		c.Elements = copyExpressions(node.Elements)
+		return &c
+	case *HashLiteral:
+		c := *node
+		c.Pairs = make(map[Expression]Expression, len(node.Pairs))
+		for k, v := range node.Pairs {
+			c.Pairs[copyExpression(k)] = copyExpression(v)
+		}
+		return &c
+	case *TupleLiteral:
+		c := *node
+		c.Elements = copyExpressions(node.Elements)
+		return &c
+	case *TuplePattern:
+		c := *node
+		c.Names = copyIdentifiers(node.Names)
+		return &c
+	case *ArrayPattern:
+		c := *node
+		c.Names = copyIdentifiers(node.Names)
+		c.Rest = copyIdentifier(node.Rest)
+		return &c
+	case *HashPattern:
+		c := *node
+		c.Names = copyIdentifiers(node.Names)
+		return &c
+	case *StructStatement:
+		c := *node
+		c.Name = copyIdentifier(node.Name)
+		c.Fields = copyIdentifiers(node.Fields)
+		return &c
+	case *StructLiteral:
+		c := *node
+		c.Type = copyExpression(node.Type)
+		c.Fields = copyIdentifiers(node.Fields)
+		c.Values = copyExpressions(node.Values)
+		return &c
+	case *FieldExpression:
+		c := *node
+		c.Object = copyExpression(node.Object)
+		c.Field = copyIdentifier(node.Field)
+		return &c
+	case *Identifier:
+		return copyIdentifier(node)
+	case *IntegerLiteral:
+		c := *node
+		return &c
+	case *FloatLiteral:
+		c := *node
+		return &c
+	case *StringLiteral:
+		c := *node
+		return &c
+	case *Boolean:
+		c := *node
+		return &c
+	}
+	// Nodes without children (break, continue) are never changed in place
+	return node
+}
+
+func copyExpression(expr Expression) Expression {
+	if expr == nil {
+		return nil
+	}
+	c, _ := Copy(expr).(Expression)
+	return c
+}
+
+func copyExpressions(exprs []Expression) []Expression {
+	if exprs == nil {
+		return nil
+	}
+	c := make([]Expression, len(exprs))
+	for i, e := range exprs {
+		c[i] = copyExpression(e)
+	}
+	return c
+}
+
+func copyPattern(pattern Pattern) Pattern {
+	if pattern == nil {
+		return nil
+	}
+	c, _ := Copy(pattern).(Pattern)
+	return c
+}
+
+func copyStatements(stmts []Statement) []Statement {
+	if stmts == nil {
+		return nil
+	}
+	c := make([]Statement, len(stmts))
+	for i, s := range stmts {
+		c[i], _ = Copy(s).(Statement)
+	}
+	return c
+}
+
+func copyBlock(block *BlockStatement) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	c := *block
+	c.Statements = copyStatements(block.Statements)
+	return &c
+}
+
+func copyIdentifier(ident *Identifier) *Identifier {
+	if ident == nil {
+		return nil
+	}
+	c := *ident
+	return &c
+}
+
+func copyIdentifiers(idents []*Identifier) []*Identifier {
+	if idents == nil {
+		return nil
+	}
+	c := make([]*Identifier, len(idents))
+	for i, ident := range idents {
+		c[i] = copyIdentifier(ident)
+	}
+	return c
+}
@@ -35,6 +35,9 @@ func Modify(node Node, modifier ModifierFunc) Node {
 		if node.Alternative != nil {
 			node.Alternative, _ = Modify(node.Alternative, modifier).(*BlockStatement)
 		}
+	case *TryExpression:
+		node.Block, _ = Modify(node.Block, modifier).(*BlockStatement)
+		node.Handler, _ = Modify(node.Handler, modifier).(*BlockStatement)
 	case *BlockStatement:
 		for i := range node.Statements {
 			node.Statements[i], _ = Modify(node.Statements[i], modifier).(Statement)
@@ -47,6 +50,37 @@ func Modify(node Node, modifier ModifierFunc) Node {
 		for i := range node.Parameters {
 			node.Parameters[i], _ = Modify(node.Parameters[i], modifier).(*Identifier)
 		}
+		for i := range node.Defaults {
+			if node.Defaults[i] != nil {
+				node.Defaults[i], _ = Modify(node.Defaults[i], modifier).(Expression)
+			}
+		}
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+	case *CallExpression:
+		node.Function, _ = Modify(node.Function, modifier).(Expression)
+		for i := range node.Arguments {
+			node.Arguments[i], _ = Modify(node.Arguments[i], modifier).(Expression)
+		}
+	case *TernaryExpression:
+		node.Condition, _ = Modify(node.Condition, modifier).(Expression)
+		node.Consequence, _ = Modify(node.Consequence, modifier).(Expression)
+		node.Alternative, _ = Modify(node.Alternative, modifier).(Expression)
+	case *Assignment:
+		node.Name, _ = Modify(node.Name, modifier).(Expression)
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+	case *WhileStatement:
+		node.Condition, _ = Modify(node.Condition, modifier).(Expression)
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+	case *ForStatement:
+		if node.Init != nil {
+			node.Init, _ = Modify(node.Init, modifier).(*LetStatement)
+		}
+		if node.Condition != nil {
+			node.Condition, _ = Modify(node.Condition, modifier).(Expression)
+		}
+		if node.Update != nil {
+			node.Update, _ = Modify(node.Update, modifier).(Expression)
+		}
 		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
 	case *ArrayLiteral:
 		for i := range node.Elements {
@@ -61,6 +95,17 @@ func Modify(node Node, modifier ModifierFunc) Node {
 			newPairs[newKey] = newVal
 		}
 		node.Pairs = newPairs
+	case *TupleLiteral:
+		for i := range node.Elements {
+			node.Elements[i], _ = Modify(node.Elements[i], modifier).(Expression)
+		}
+	case *StructLiteral:
+		node.Type, _ = Modify(node.Type, modifier).(Expression)
+		for i := range node.Values {
+			node.Values[i], _ = Modify(node.Values[i], modifier).(Expression)
+		}
+	case *FieldExpression:
+		node.Object, _ = Modify(node.Object, modifier).(Expression)
 	}
 	// We REPLACE the node passed in as the argument with the node returned by the call
 	// Important that we return instead of just modifying the given node so we can actually replace them
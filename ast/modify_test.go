@@ -131,6 +131,50 @@ func TestModify(t *testing.T) {
 			&ArrayLiteral{Elements: []Expression{one(), one()}},
 			&ArrayLiteral{Elements: []Expression{two(), two()}},
 		},
+		{
+			&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{one(), one()}},
+			&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{two(), two()}},
+		},
+		{
+			&TernaryExpression{Condition: one(), Consequence: one(), Alternative: one()},
+			&TernaryExpression{Condition: two(), Consequence: two(), Alternative: two()},
+		},
+		{
+			&Assignment{Name: &Identifier{Value: "x"}, Value: one()},
+			&Assignment{Name: &Identifier{Value: "x"}, Value: two()},
+		},
+		{
+			&WhileStatement{
+				Condition: one(),
+				Body: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+					},
+				},
+			},
+			&WhileStatement{
+				Condition: two(),
+				Body: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+					},
+				},
+			},
+		},
+		{
+			&ForStatement{
+				Init:      &LetStatement{Value: one()},
+				Condition: one(),
+				Update:    one(),
+				Body:      &BlockStatement{Statements: []Statement{}},
+			},
+			&ForStatement{
+				Init:      &LetStatement{Value: two()},
+				Condition: two(),
+				Update:    two(),
+				Body:      &BlockStatement{Statements: []Statement{}},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -162,3 +206,38 @@ func TestModify(t *testing.T) {
 	}
 
 }
+
+func TestCopy(t *testing.T) {
+	original := &Program{
+		Statements: []Statement{
+			&ExpressionStatement{Expression: &InfixExpression{
+				Left:     &IntegerLiteral{Value: 1},
+				Operator: "+",
+				Right: &CallExpression{
+					Function:  &Identifier{Value: "f"},
+					Arguments: []Expression{&IntegerLiteral{Value: 1}},
+				},
+			}},
+		},
+	}
+
+	copied := Copy(original)
+	if !reflect.DeepEqual(original, copied) {
+		t.Fatalf("copy is not equal to original. got=%#v", copied)
+	}
+
+	Modify(copied, func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok {
+			return node
+		}
+		integer.Value = 2
+		return integer
+	})
+
+	infix := original.Statements[0].(*ExpressionStatement).Expression.(*InfixExpression)
+	call := infix.Right.(*CallExpression)
+	if infix.Left.(*IntegerLiteral).Value != 1 || call.Arguments[0].(*IntegerLiteral).Value != 1 {
+		t.Errorf("modifying the copy changed the original. got=%s", original.String())
+	}
+}
@@ -14,6 +14,7 @@ import (
 )
 
 var engine = flag.String("engine", "vm", "use 'vm' or 'eval'")
+var optimize = flag.Bool("optimize", false, "optimize the bytecode, vm only")
 
 var input = `
 let fibonacci = funk(x) {
@@ -42,6 +43,7 @@ func main() {
 
 	if *engine == "vm" {
 		comp := compiler.New()
+		comp.Optimize = *optimize
 		err := comp.Compile(program)
 		if err != nil {
 			fmt.Printf("compiler error: %s", err)
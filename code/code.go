@@ -31,12 +31,15 @@ const (
 	// Binary operators
 	OpAdd
 	OpPop
+	OpDup // Push copies of the values on top of the stack, e.g. the collection and the index of a[i] += 1
 	OpSub
 	OpMul
 	OpDiv
+	OpMod
 	OpEqual
 	OpNotEqual
 	OpGreaterThan
+	OpGreaterThanOrEqual
 	OpAmpersand
 	OpPipe
 	OpExponent
@@ -65,15 +68,38 @@ const (
 	OpArray
 	OpHash
 	OpIndex
+	OpSetIndex
+	OpStruct   // Create a struct from its type and the fields given in the literal
+	OpGetField // Read a field of a struct
+	OpSetField // Write a field of a struct, leaving the value on the stack
+	OpTuple
+	OpUnpackTuple // Replace a tuple with its elements, first element deepest in the stack
+	OpUnpackArray // Like OpUnpackTuple, for an array
+	OpUnpackHash  // Like OpUnpackTuple, for the values of some keys of a hash
 
 	// Functions
 	OpCall        // Tell the VM to start executing *object.CompiledFunction
+	OpTailCall    // Like OpCall, but the callee takes over the frame of the caller. Its result is returned right away
 	OpReturnValue // Return value must be on top of the stack
 	OpReturn      // Return no value, resume to parent execution
 	OpGetBuiltin
 	OpClosure
 	OpGetFree        // Get free variables
+	OpSetFree        // Overwrite a free variable of the current closure
+	OpGetLocalCell   // Load the cell of a local captured by a closure, creating it on first capture
+	OpGetFreeCell    // Load the cell of a free variable captured by a nested closure
 	OpCurrentClosure // Load the closure it's executing on to the stack (to execute recursive function)
+	OpJumpIfPassed   // Skip the default value of a parameter the call passed an argument for
+
+	// Error handling
+	OpTry    // Install an error handler that jumps to the catch block
+	OpEndTry // Remove the innermost error handler, the try block finished without errors
+
+	// Superinstructions, emitted by the optimizer in place of common sequences
+	// so the VM dispatches once instead of three times.
+	// The first operand is the opcode of the binary operator or comparison
+	OpBinaryLocalConstant // OpGetLocal, OpConstant, operator
+	OpBinaryConstantLocal // OpConstant, OpGetLocal, operator
 )
 
 // How an instruction looks like
@@ -91,28 +117,32 @@ var definitions = map[Opcode]*Definition{
 	// We won't be having more than 65536 references aka values that exceed 65536.
 	OpConstant: {"OpConstant", []int{2}},
 	// No operand
-	OpAdd:         {"OpAdd", []int{}},
-	OpPop:         {"OpPop", []int{}},
-	OpSub:         {"OpSub", []int{}},
-	OpMul:         {"OpMul", []int{}},
-	OpDiv:         {"OpDiv", []int{}},
-	OpTrue:        {"OpTrue", []int{}},
-	OpFalse:       {"OpFalse", []int{}},
-	OpEqual:       {"OpEqual", []int{}},
-	OpNotEqual:    {"OpNotEqual", []int{}},
-	OpGreaterThan: {"OpGreaterThan", []int{}},
-	OpAmpersand:   {"OpAmpersand", []int{}},
-	OpMinus:       {"OpMinus", []int{}},
-	OpBang:        {"OpBang", []int{}},
-	OpTilde:       {"OpTilde", []int{}},
-	OpPipe:        {"OpPipe", []int{}},
-	OpRShift:      {"OpRShift", []int{}},
-	OpLShift:      {"OpLShift", []int{}},
-	OpExponent:    {"OpExponent", []int{}},
-	OpPreInc:      {"OpPreInc", []int{}},
-	OpPreDec:      {"OpPreDec", []int{}},
-	OpPostInc:     {"OpPostInc", []int{}},
-	OpPostDec:     {"OpPostDec", []int{}},
+	OpAdd: {"OpAdd", []int{}},
+	OpPop: {"OpPop", []int{}},
+	// Operand is the number of values to copy
+	OpDup:                {"OpDup", []int{1}},
+	OpSub:                {"OpSub", []int{}},
+	OpMul:                {"OpMul", []int{}},
+	OpDiv:                {"OpDiv", []int{}},
+	OpMod:                {"OpMod", []int{}},
+	OpTrue:               {"OpTrue", []int{}},
+	OpFalse:              {"OpFalse", []int{}},
+	OpEqual:              {"OpEqual", []int{}},
+	OpNotEqual:           {"OpNotEqual", []int{}},
+	OpGreaterThan:        {"OpGreaterThan", []int{}},
+	OpGreaterThanOrEqual: {"OpGreaterThanOrEqual", []int{}},
+	OpAmpersand:          {"OpAmpersand", []int{}},
+	OpMinus:              {"OpMinus", []int{}},
+	OpBang:               {"OpBang", []int{}},
+	OpTilde:              {"OpTilde", []int{}},
+	OpPipe:               {"OpPipe", []int{}},
+	OpRShift:             {"OpRShift", []int{}},
+	OpLShift:             {"OpLShift", []int{}},
+	OpExponent:           {"OpExponent", []int{}},
+	OpPreInc:             {"OpPreInc", []int{}},
+	OpPreDec:             {"OpPreDec", []int{}},
+	OpPostInc:            {"OpPostInc", []int{}},
+	OpPostDec:            {"OpPostDec", []int{}},
 	// We currently do absolute jump here
 	// The operand is the index of the instruction
 	OpJump:          {"OpJump", []int{2}},
@@ -126,9 +156,27 @@ var definitions = map[Opcode]*Definition{
 	// Operand is number of values in an array
 	OpArray: {"OpArray", []int{2}},
 	// Operand is number of values x2 in a hash
-	OpHash:        {"OpHash", []int{2}},
-	OpIndex:       {"OpIndex", []int{}},
+	OpHash:  {"OpHash", []int{2}},
+	OpIndex: {"OpIndex", []int{}},
+	// Stack holds the collection, the index and the value, in that order
+	OpSetIndex: {"OpSetIndex", []int{}},
+	// Operand is the number of fields given, the stack holds the struct type
+	// followed by the name and the value of each of them
+	OpStruct: {"OpStruct", []int{2}},
+	// Operand is the constant holding the name of the field.
+	// OpSetField expects the struct and the value on the stack, in that order
+	OpGetField: {"OpGetField", []int{2}},
+	OpSetField: {"OpSetField", []int{2}},
+	// Operand is number of values in a tuple
+	OpTuple: {"OpTuple", []int{2}},
+	// Operand is the number of values the tuple must hold
+	OpUnpackTuple: {"OpUnpackTuple", []int{2}},
+	// Operands are the number of elements to unpack, and 1 if the elements left over are collected into an array
+	OpUnpackArray: {"OpUnpackArray", []int{2, 1}},
+	// Operand is the number of keys, the stack holds the hash followed by the keys
+	OpUnpackHash:  {"OpUnpackHash", []int{2}},
 	OpCall:        {"OpCall", []int{1}},
+	OpTailCall:    {"OpTailCall", []int{1}},
 	OpReturnValue: {"OpReturnValue", []int{}},
 	OpReturn:      {"OpReturn", []int{}},
 	// Define up to 256 builtin functions
@@ -139,7 +187,28 @@ var definitions = map[Opcode]*Definition{
 	// The 2nd operand specifies how many free variables sit on the stack and to-be-transferred to the closure. 1 byte (256 free variables) should be enough?
 	OpClosure:        {"OpClosure", []int{2, 1}},
 	OpGetFree:        {"OpGetFree", []int{1}},
+	OpSetFree:        {"OpSetFree", []int{1}},
+	OpGetLocalCell:   {"OpGetLocalCell", []int{1}},
+	OpGetFreeCell:    {"OpGetFreeCell", []int{1}},
 	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	// Where to jump, like OpJump, and the index of the parameter
+	OpJumpIfPassed: {"OpJumpIfPassed", []int{2, 1}},
+	// The operand is the absolute position of the catch block, like a jump
+	OpTry:    {"OpTry", []int{2}},
+	OpEndTry: {"OpEndTry", []int{}},
+	// Operator, local index, constant index
+	OpBinaryLocalConstant: {"OpBinaryLocalConstant", []int{1, 1, 2}},
+	// Operator, constant index, local index
+	OpBinaryConstantLocal: {"OpBinaryConstantLocal", []int{1, 2, 1}},
+}
+
+// Return the number of bytes taken by the operands of an instruction
+func (def *Definition) Width() int {
+	width := 0
+	for _, w := range def.OperandWidths {
+		width += w
+	}
+	return width
 }
 
 func Lookup(op byte) (*Definition, error) {
@@ -225,10 +294,17 @@ func (ins Instructions) String() string {
 	for i < len(ins) {
 		def, err := Lookup(ins[i])
 		if err != nil {
-			fmt.Fprintf(&out, "ERROR:%s\n", err)
+			// Skip the unknown byte, we can't tell how many operands it has
+			fmt.Fprintf(&out, "%04d ERROR: %s\n", i, err)
+			i++
 			continue
 		}
 
+		if i+1+def.Width() > len(ins) {
+			fmt.Fprintf(&out, "%04d ERROR: %s is missing its operands\n", i, def.Name)
+			break
+		}
+
 		// Skip the opcode and read the operands
 		operands, offset := ReadOperands(def, ins[i+1:])
 
@@ -256,6 +332,8 @@ func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
 		return fmt.Sprintf("%s %d", def.Name, operands[0])
 	case 2:
 		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	case 3: // Superinstructions
+		return fmt.Sprintf("%s %d %d %d", def.Name, operands[0], operands[1], operands[2])
 	}
 
 	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
@@ -63,6 +63,22 @@ func TestInstructionsString(t *testing.T) {
 	}
 }
 
+func TestInstructionsStringWithBadInstructions(t *testing.T) {
+	ins := Instructions{byte(OpAdd), 255, byte(OpPop)}
+	ins = append(ins, Make(OpConstant, 1)[:2]...)
+
+	expected := `0000 OpAdd
+0001 ERROR: opcode 255 undefined
+0002 OpPop
+0003 ERROR: OpConstant is missing its operands
+`
+
+	if ins.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nwant: %q\ngot :%q",
+			expected, ins.String())
+	}
+}
+
 func TestReadOperands(t *testing.T) {
 	tests := []struct {
 		op        Opcode
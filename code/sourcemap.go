@@ -0,0 +1,48 @@
+package code
+
+import (
+	"sort"
+
+	"s8/token"
+)
+
+// Map instruction offsets back to the source positions they were compiled from,
+// so errors raised while running bytecode can point at the source code.
+// Only the offsets where the position changes are stored
+type SourceMap struct {
+	Offsets   []int
+	Positions []token.Position
+}
+
+// Record that the instruction at offset was compiled from the source at pos
+func (sm *SourceMap) Add(offset int, pos token.Position) {
+	n := len(sm.Offsets)
+
+	// An instruction was removed and another one emitted in its place
+	if n > 0 && sm.Offsets[n-1] >= offset {
+		for n > 0 && sm.Offsets[n-1] >= offset {
+			n--
+		}
+		sm.Offsets = sm.Offsets[:n]
+		sm.Positions = sm.Positions[:n]
+	}
+
+	if n > 0 && sm.Positions[n-1] == pos {
+		return
+	}
+
+	sm.Offsets = append(sm.Offsets, offset)
+	sm.Positions = append(sm.Positions, pos)
+}
+
+// Return the source position of the instruction containing offset,
+// or the zero position if we know nothing about it
+func (sm *SourceMap) Lookup(offset int) token.Position {
+	// Find the last entry starting at or before offset
+	i := sort.Search(len(sm.Offsets), func(i int) bool { return sm.Offsets[i] > offset })
+	if i == 0 {
+		return token.Position{}
+	}
+
+	return sm.Positions[i-1]
+}
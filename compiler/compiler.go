@@ -7,6 +7,7 @@ import (
 	"s8/ast"
 	"s8/code"
 	"s8/object"
+	"s8/token"
 )
 
 type Compiler struct {
@@ -18,12 +19,23 @@ type Compiler struct {
 	// A stack of compilation scopes. Each scope is for a compiled function
 	scopes     []CompilationScope
 	scopeIndex int
+	// Position of the node being compiled,
+	// recorded in the source map of every instruction we emit
+	position token.Position
+
+	// Fold constant expressions, keep one copy of each constant in the pool,
+	// drop unreachable statements and shortcut jumps to jumps.
+	// Off by default, so the bytecode maps one to one to the source
+	Optimize bool
+	// Pool indexes of the constants added so far, when optimizing
+	constantIndexes map[constantKey]int
 }
 
 // Compiled bytecode
 type Bytecode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+	SourceMap    code.SourceMap
 }
 
 // Keep track of previously emitted instructions
@@ -37,6 +49,27 @@ type CompilationScope struct {
 	instructions        code.Instructions
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+	// A stack of the loops we are currently compiling.
+	// Each scope has its own, so break/continue cannot jump out of a function
+	loops []*LoopContext
+	// How many try blocks we are currently compiling, see LoopContext.tries
+	tries int
+	// Source positions of the instructions in this scope
+	sourceMap code.SourceMap
+	// The calls ending the branches of the if or ternary expression that ends at branchesEnd.
+	// They are in tail position if that expression is
+	branchCalls []int
+	branchesEnd int
+}
+
+// Keep track of the jumps emitted by break and continue statements
+// so we can back-patch them once we know where the loop ends
+type LoopContext struct {
+	breakPositions    []int
+	continuePositions []int
+	// The number of enclosing try blocks when the loop started.
+	// Jumping out of a try block with break/continue has to remove its error handler first
+	tries int
 }
 
 func New() *Compiler {
@@ -74,6 +107,19 @@ func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
 }
 
 func (c *Compiler) Compile(node ast.Node) error {
+	// e.g., the empty expression of a stray semicolon
+	if node == nil {
+		return nil
+	}
+
+	// Instructions emitted from here on belong to this node,
+	// until we are done with it and go back to the position of the parent node
+	if pos := node.Pos(); pos.IsValid() {
+		parent := c.position
+		c.position = pos
+		defer func() { c.position = parent }()
+	}
+
 	// Similar structure like Evaf l()
 	switch node := node.(type) {
 	case *ast.Program:
@@ -82,6 +128,9 @@ func (c *Compiler) Compile(node ast.Node) error {
 			if err != nil {
 				return err
 			}
+			if c.Optimize && isTerminal(s) {
+				break
+			}
 		}
 	case *ast.ExpressionStatement:
 		err := c.Compile(node.Expression)
@@ -90,8 +139,19 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.emit(code.OpPop)
 	case *ast.InfixExpression:
+		if c.Optimize {
+			if folded, ok := c.fold(node); ok {
+				c.emitFolded(folded)
+				return nil
+			}
+		}
+
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
+		}
+
 		// Reordering the operands
-		if node.Operator == "<" {
+		if node.Operator == "<" || node.Operator == "<=" {
 			err := c.Compile(node.Right)
 			if err != nil {
 				return err
@@ -102,7 +162,11 @@ func (c *Compiler) Compile(node ast.Node) error {
 				return err
 			}
 
-			c.emit(code.OpGreaterThan)
+			if node.Operator == "<" {
+				c.emit(code.OpGreaterThan)
+			} else {
+				c.emit(code.OpGreaterThanOrEqual)
+			}
 			return nil
 		}
 
@@ -116,37 +180,14 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 
-		switch node.Operator {
-		case "+":
-			c.emit(code.OpAdd)
-		case "-":
-			c.emit(code.OpSub)
-		case "*":
-			c.emit(code.OpMul)
-		case "/":
-			c.emit(code.OpDiv)
-		case ">":
-			c.emit(code.OpGreaterThan)
-		case "==":
-			c.emit(code.OpEqual)
-		case "!=":
-			c.emit(code.OpNotEqual)
-		case "|":
-			c.emit(code.OpPipe)
-		case ">>":
-			c.emit(code.OpRShift)
-		case "<<":
-			c.emit(code.OpLShift)
-		case "^":
-			c.emit(code.OpExponent)
-		case "&":
-			c.emit(code.OpAmpersand)
-		default:
-			return fmt.Errorf("unknown operator: %s", node.Operator)
-		}
+		return c.emitOperator(node.Operator)
 	case *ast.IntegerLiteral:
 		integer := &object.Integer{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(integer))
+	case *ast.FloatLiteral:
+		// Round at compile time just like the evaluator does
+		float := &object.Float{Value: object.ToFixed(node.Value, object.FloatPrecision)}
+		c.emit(code.OpConstant, c.addConstant(float))
 	case *ast.Boolean:
 		if node.Value {
 			c.emit(code.OpTrue)
@@ -154,6 +195,18 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpFalse)
 		}
 	case *ast.PrefixExpression:
+		if c.Optimize {
+			if folded, ok := c.fold(node); ok {
+				c.emitFolded(folded)
+				return nil
+			}
+		}
+
+		// Incrementing a variable writes the new value back to it
+		if node.Operator == "++" || node.Operator == "--" {
+			return c.compileIncrement(node.Right, node.Operator, false)
+		}
+
 		err := c.Compile(node.Right)
 		if err != nil {
 			return err
@@ -166,27 +219,15 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpMinus)
 		case "~":
 			c.emit(code.OpTilde)
-		case "++":
-			c.emit(code.OpPreInc)
-		case "--":
-			c.emit(code.OpPreDec)
 		default:
-			return fmt.Errorf("unknown operator: %s", node.Operator)
+			return errorAt(c.position, "unknown operator: %s", node.Operator)
 		}
 	case *ast.PostfixExpression:
-		err := c.Compile(node.Left)
-		if err != nil {
-			return err
-		}
-
-		switch node.Operator {
-		case "++":
-			c.emit(code.OpPostInc)
-		case "--":
-			c.emit(code.OpPostDec)
-		default:
-			return fmt.Errorf("unknown operator: %s", node.Operator)
+		// Keep the old value on the stack and write the new one back to the variable
+		if node.Operator == "++" || node.Operator == "--" {
+			return c.compileIncrement(node.Left, node.Operator, true)
 		}
+		return errorAt(c.position, "unknown operator: %s", node.Operator)
 	case *ast.IfExpression:
 		err := c.Compile(node.Condition)
 		if err != nil {
@@ -214,7 +255,12 @@ func (c *Compiler) Compile(node ast.Node) error {
 		// }
 		if c.lastInstructionIs(code.OpPop) {
 			c.removeLastPop()
+		} else if !c.lastInstructionIs(code.OpReturnValue) {
+			// The block ends with a statement that leaves nothing behind
+			// e.g., a let, a loop or a break, so we push Null ourselves
+			c.emit(code.OpNull)
 		}
+		branchCalls := c.endingCalls()
 
 		// We need this whether we have the Alternative or not
 		// to jump to the next instruction after If-Else
@@ -234,20 +280,255 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 			if c.lastInstructionIs(code.OpPop) {
 				c.removeLastPop()
+			} else if !c.lastInstructionIs(code.OpReturnValue) {
+				c.emit(code.OpNull)
 			}
+			branchCalls = append(branchCalls, c.endingCalls()...)
 		}
 		// If not truthy but we have Alternatiive, jump to statements outside of Else block
 		// If not truthy but there is no Alternative, jump to OpNull
 		afterAlternativePos := len(c.currentInstructions())
 		c.changeOperand(jumpPos, afterAlternativePos)
+		c.setBranchCalls(branchCalls, afterAlternativePos)
+	case *ast.TryExpression:
+		// OpTry installs a handler pointing at the catch block.
+		// If the try block finishes, OpEndTry removes it and we jump over the catch block.
+		// If it raises an error, the VM unwinds to the handler
+		// and pushes the caught error for the catch block to bind
+		tryPos := c.emit(code.OpTry, 9999)
+
+		c.scopes[c.scopeIndex].tries++
+		err := c.Compile(node.Block)
+		c.scopes[c.scopeIndex].tries--
+		if err != nil {
+			return err
+		}
+
+		// Leave the value of the block on the stack, just like *ast.IfExpression
+		if c.lastInstructionIs(code.OpPop) {
+			c.removeLastPop()
+		} else if !c.lastInstructionIs(code.OpReturnValue) {
+			c.emit(code.OpNull)
+		}
+
+		c.emit(code.OpEndTry)
+		jumpPos := c.emit(code.OpJump, 9999)
+
+		c.changeOperand(tryPos, len(c.currentInstructions()))
+
+		symbol := c.symbolTable.Define(node.Param.Value)
+		c.storeSymbol(symbol)
+
+		err = c.Compile(node.Handler)
+		if err != nil {
+			return err
+		}
+
+		if c.lastInstructionIs(code.OpPop) {
+			c.removeLastPop()
+		} else if !c.lastInstructionIs(code.OpReturnValue) {
+			c.emit(code.OpNull)
+		}
+
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+	case *ast.TernaryExpression:
+		// Same jumps as *ast.IfExpression, but both branches are expressions
+		// that already leave exactly one value on the stack, so there is no OpPop to remove
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		err = c.Compile(node.Consequence)
+		if err != nil {
+			return err
+		}
+		branchCalls := c.endingCalls()
+
+		jumpPos := c.emit(code.OpJump, 9999)
+
+		afterConsequencePos := len(c.currentInstructions())
+		c.changeOperand(jumpNotTruthyPos, afterConsequencePos)
+
+		err = c.Compile(node.Alternative)
+		if err != nil {
+			return err
+		}
+		branchCalls = append(branchCalls, c.endingCalls()...)
+
+		afterAlternativePos := len(c.currentInstructions())
+		c.changeOperand(jumpPos, afterAlternativePos)
+		c.setBranchCalls(branchCalls, afterAlternativePos)
+	case *ast.WhileStatement:
+		// Jump back here after each iteration to re-evaluate the condition
+		loopStartPos := len(c.currentInstructions())
+
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		c.enterLoop()
+		err = c.Compile(node.Body)
+		if err != nil {
+			return err
+		}
+		loop := c.leaveLoop()
+
+		c.emit(code.OpJump, loopStartPos)
+
+		afterLoopPos := len(c.currentInstructions())
+		c.changeOperand(jumpNotTruthyPos, afterLoopPos)
+		// A continue in a while loop goes straight to the condition
+		c.patchLoopJumps(loop, loopStartPos, afterLoopPos)
+	case *ast.ForStatement:
+		if node.Init != nil {
+			err := c.Compile(node.Init)
+			if err != nil {
+				return err
+			}
+		}
+
+		loopStartPos := len(c.currentInstructions())
+
+		// No condition means we loop until we hit a break or a return
+		jumpNotTruthyPos := -1
+		if node.Condition != nil {
+			err := c.Compile(node.Condition)
+			if err != nil {
+				return err
+			}
+			jumpNotTruthyPos = c.emit(code.OpJumpNotTruthy, 9999)
+		}
+
+		c.enterLoop()
+		err := c.Compile(node.Body)
+		if err != nil {
+			return err
+		}
+		loop := c.leaveLoop()
+
+		// A continue in a for loop still needs to run the update expression
+		updatePos := len(c.currentInstructions())
+		if node.Update != nil {
+			err := c.Compile(node.Update)
+			if err != nil {
+				return err
+			}
+			// The update expression is only run for its side effects
+			c.emit(code.OpPop)
+		}
+
+		c.emit(code.OpJump, loopStartPos)
+
+		afterLoopPos := len(c.currentInstructions())
+		if jumpNotTruthyPos != -1 {
+			c.changeOperand(jumpNotTruthyPos, afterLoopPos)
+		}
+		c.patchLoopJumps(loop, updatePos, afterLoopPos)
+	case *ast.BreakStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return errorAt(c.position, "break outside of loop")
+		}
+		c.leaveTries(loop)
+		// We don't know where the loop ends yet, so back-patch it later
+		pos := c.emit(code.OpJump, 9999)
+		loop.breakPositions = append(loop.breakPositions, pos)
+	case *ast.ContinueStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return errorAt(c.position, "continue outside of loop")
+		}
+		c.leaveTries(loop)
+		pos := c.emit(code.OpJump, 9999)
+		loop.continuePositions = append(loop.continuePositions, pos)
+	case *ast.Assignment:
+		switch name := node.Name.(type) {
+		case *ast.Identifier:
+			symbol, err := c.resolveAssignable(name)
+			if err != nil {
+				return err
+			}
+
+			if node.Operator != "" {
+				c.loadSymbols(symbol)
+			}
+			err = c.compileAssignedValue(node)
+			if err != nil {
+				return err
+			}
+
+			// Assignment is an expression,
+			// so we load the new value back on to the stack after storing it
+			c.storeSymbol(symbol)
+			c.loadSymbols(symbol)
+		case *ast.IndexExpression:
+			err := c.Compile(name.Left)
+			if err != nil {
+				return err
+			}
+
+			err = c.Compile(name.Index)
+			if err != nil {
+				return err
+			}
+
+			// Read the current element with copies of the collection and the index,
+			// which are evaluated only once
+			if node.Operator != "" {
+				c.emit(code.OpDup, 2)
+				c.emit(code.OpIndex)
+			}
+			err = c.compileAssignedValue(node)
+			if err != nil {
+				return err
+			}
+
+			// The VM leaves the assigned value on the stack for us
+			c.emit(code.OpSetIndex)
+		case *ast.FieldExpression:
+			err := c.Compile(name.Object)
+			if err != nil {
+				return err
+			}
+
+			if node.Operator != "" {
+				c.emit(code.OpDup, 1)
+				c.emit(code.OpGetField, c.addConstant(&object.String{Value: name.Field.Value}))
+			}
+			err = c.compileAssignedValue(node)
+			if err != nil {
+				return err
+			}
+
+			c.emit(code.OpSetField, c.addConstant(&object.String{Value: name.Field.Value}))
+		default:
+			return errorAt(node.Name.Pos(), "cannot assign to %s", node.Name.String())
+		}
 	case *ast.BlockStatement:
 		for _, s := range node.Statements {
 			err := c.Compile(s)
 			if err != nil {
 				return err
 			}
+			if c.Optimize && isTerminal(s) {
+				break
+			}
 		}
 	case *ast.LetStatement:
+		if node.Pattern != nil {
+			err := c.Compile(node.Value)
+			if err != nil {
+				return err
+			}
+			return c.compilePattern(node.Pattern)
+		}
+
 		// Define the name to which a function will be bound in the symbol symbol table
 		// right before the body is compiled
 		symbol := c.symbolTable.Define(node.Name.Value)
@@ -260,12 +541,42 @@ func (c *Compiler) Compile(node ast.Node) error {
 		} else {
 			c.emit(code.OpSetLocal, symbol.Index)
 		}
+	case *ast.StructStatement:
+		st := &object.StructType{Name: node.Name.Value, Fields: []string{}}
+		for _, field := range node.Fields {
+			st.Fields = append(st.Fields, field.Value)
+		}
+
+		symbol := c.symbolTable.Define(node.Name.Value)
+		c.emit(code.OpConstant, c.addConstant(st))
+		c.storeSymbol(symbol)
+	case *ast.StructLiteral:
+		err := c.Compile(node.Type)
+		if err != nil {
+			return err
+		}
+
+		for i, field := range node.Fields {
+			c.emit(code.OpConstant, c.addConstant(&object.String{Value: field.Value}))
+			err := c.Compile(node.Values[i])
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpStruct, len(node.Fields))
+	case *ast.FieldExpression:
+		err := c.Compile(node.Object)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpGetField, c.addConstant(&object.String{Value: node.Field.Value}))
 	case *ast.Identifier:
 		symbol, ok := c.symbolTable.Resolve(node.Value)
 		if !ok {
 			// A compile-time error!
 			// With our evaluator we cannot throw an error before we pass bytecode to the VM
-			return fmt.Errorf("undefined variable %s", node.Value)
+			return errorAt(c.position, "undefined variable %s", node.Value)
 		}
 		c.loadSymbols(symbol)
 	case *ast.StringLiteral:
@@ -279,6 +590,14 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 		c.emit(code.OpArray, len(node.Elements))
+	case *ast.TupleLiteral:
+		for _, el := range node.Elements {
+			err := c.Compile(el)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpTuple, len(node.Elements))
 	case *ast.HashLiteral:
 		keys := []ast.Expression{}
 		for k := range node.Pairs {
@@ -323,11 +642,21 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 		// Define function arguments as local bindings
-		for _, p := range node.Parameters {
-			c.symbolTable.Define(p.Value)
+		params := make([]Symbol, len(node.Parameters))
+		for i, p := range node.Parameters {
+			params[i] = c.symbolTable.Define(p.Value)
+		}
+		// The VM collects the rest of the arguments into the local after the parameters
+		if node.Rest != nil {
+			c.symbolTable.Define(node.Rest.Value)
 		}
 
-		err := c.Compile(node.Body)
+		numDefaults, err := c.compileParameters(node, params)
+		if err != nil {
+			return err
+		}
+
+		err = c.Compile(node.Body)
 		if err != nil {
 			return err
 		}
@@ -344,16 +673,29 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		freeSymbols := c.symbolTable.FreeSymbols
 		numLocals := c.symbolTable.numDefinitions
+		sourceMap := c.scopes[c.scopeIndex].sourceMap
 		instructions := c.leaveScope()
+		if c.Optimize {
+			threadJumps(instructions)
+			instructions, sourceMap = fuseInstructions(instructions, sourceMap)
+		}
 
-		// Emit OpGetFree
+		// Load the cells of the free variables, so the closure shares them with this scope
 		for _, s := range freeSymbols {
-			c.loadSymbols(s)
+			c.loadCell(s)
 		}
 
 		// Change where compiled instructions are stored
 		// and this time they are not in the main scope
-		compiledFn := &object.CompiledFunction{Instructions: instructions, NumLocals: numLocals, NumParameters: len(node.Parameters)}
+		compiledFn := &object.CompiledFunction{
+			Instructions:  instructions,
+			NumLocals:     numLocals,
+			NumParameters: len(node.Parameters),
+			NumDefaults:   numDefaults,
+			Variadic:      node.Rest != nil,
+			SourceMap:     sourceMap,
+			Name:          node.Name,
+		}
 
 		fnIndex := c.addConstant(compiledFn)
 		// Turning all functions to closures
@@ -366,6 +708,9 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 
+		for _, pos := range c.endingCalls() {
+			c.makeTailCall(pos)
+		}
 		c.emit(code.OpReturnValue)
 	case *ast.CallExpression:
 		err := c.Compile(node.Function)
@@ -388,14 +733,35 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 // Return compiled bytecode
 func (c *Compiler) Bytecode() *Bytecode {
+	instructions := c.currentInstructions()
+	sourceMap := c.scopes[c.scopeIndex].sourceMap
+	if c.Optimize {
+		threadJumps(instructions)
+		// Returns new instructions, the compiler may still add to its own
+		instructions, sourceMap = fuseInstructions(instructions, sourceMap)
+	}
+
 	return &Bytecode{
-		Instructions: c.currentInstructions(),
+		Instructions: instructions,
 		Constants:    c.constants,
+		SourceMap:    sourceMap,
 	}
 }
 
 // Add the result of evaluation to the constant pool
 func (c *Compiler) addConstant(obj object.Object) int {
+	if c.Optimize {
+		if key, ok := newConstantKey(obj); ok {
+			if idx, ok := c.constantIndexes[key]; ok {
+				return idx
+			}
+			if c.constantIndexes == nil {
+				c.constantIndexes = map[constantKey]int{}
+			}
+			c.constantIndexes[key] = len(c.constants)
+		}
+	}
+
 	c.constants = append(c.constants, obj)
 	// Return the index of the object at the end of the pool
 	// The index also works as the identifier
@@ -409,6 +775,7 @@ func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 	pos := c.addInstruction(ins)
 
 	c.setLastInstruction(op, pos)
+	c.scopes[c.scopeIndex].sourceMap.Add(pos, c.position)
 	return pos
 }
 
@@ -465,6 +832,154 @@ func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
 	}
 }
 
+// Compute the default values of the parameters at the start of a function,
+// for the ones the call left out, and take apart the arguments of the pattern parameters.
+// Return how many parameters have a default
+func (c *Compiler) compileParameters(node *ast.FunctionLiteral, params []Symbol) (int, error) {
+	numDefaults := 0
+
+	for i := range params {
+		if i < len(node.Defaults) && node.Defaults[i] != nil {
+			numDefaults++
+
+			jumpPos := c.emit(code.OpJumpIfPassed, 9999, i)
+
+			err := c.Compile(node.Defaults[i])
+			if err != nil {
+				return 0, err
+			}
+			c.storeSymbol(params[i])
+
+			c.replaceInstruction(jumpPos, code.Make(code.OpJumpIfPassed, len(c.currentInstructions()), i))
+		}
+
+		// Take the argument apart right away, so the defaults after it can use the names it binds
+		if i < len(node.Patterns) && node.Patterns[i] != nil {
+			c.loadSymbols(params[i])
+			err := c.compilePattern(node.Patterns[i])
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return numDefaults, nil
+}
+
+// Emit the instruction of a binary operator whose operands are on the stack in order
+func (c *Compiler) emitOperator(operator string) error {
+	switch operator {
+	case "+":
+		c.emit(code.OpAdd)
+	case "-":
+		c.emit(code.OpSub)
+	case "*":
+		c.emit(code.OpMul)
+	case "/":
+		c.emit(code.OpDiv)
+	case "%":
+		c.emit(code.OpMod)
+	case ">":
+		c.emit(code.OpGreaterThan)
+	case ">=":
+		c.emit(code.OpGreaterThanOrEqual)
+	case "==":
+		c.emit(code.OpEqual)
+	case "!=":
+		c.emit(code.OpNotEqual)
+	case "|":
+		c.emit(code.OpPipe)
+	case ">>":
+		c.emit(code.OpRShift)
+	case "<<":
+		c.emit(code.OpLShift)
+	case "^":
+		c.emit(code.OpExponent)
+	case "&":
+		c.emit(code.OpAmpersand)
+	default:
+		return errorAt(c.position, "unknown operator: %s", operator)
+	}
+	return nil
+}
+
+// Compile ++ or -- on a variable, an array or hash element or a struct field, writing the new value back.
+// The value left on the stack is the new one, or the old one for postfix operators.
+// Anything else, e.g. 5++, is an error, like in the evaluator
+func (c *Compiler) compileIncrement(target ast.Expression, operator string, postfix bool) error {
+	step, stepBack := code.OpPreInc, code.OpPreDec
+	if operator == "--" {
+		step, stepBack = code.OpPreDec, code.OpPreInc
+	}
+
+	switch target := target.(type) {
+	case *ast.Identifier:
+		symbol, err := c.resolveAssignable(target)
+		if err != nil {
+			return err
+		}
+
+		c.loadSymbols(symbol)
+		if postfix {
+			c.loadSymbols(symbol)
+		}
+		c.emit(step)
+		c.storeSymbol(symbol)
+		if !postfix {
+			c.loadSymbols(symbol)
+		}
+		return nil
+	case *ast.IndexExpression:
+		err := c.Compile(target.Left)
+		if err != nil {
+			return err
+		}
+		err = c.Compile(target.Index)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpDup, 2)
+		c.emit(code.OpIndex)
+		c.emit(step)
+		c.emit(code.OpSetIndex)
+	case *ast.FieldExpression:
+		err := c.Compile(target.Object)
+		if err != nil {
+			return err
+		}
+
+		name := c.addConstant(&object.String{Value: target.Field.Value})
+		c.emit(code.OpDup, 1)
+		c.emit(code.OpGetField, name)
+		c.emit(step)
+		c.emit(code.OpSetField, name)
+	default:
+		return errorAt(c.position, "%s", object.IncrementError(target))
+	}
+
+	// The element or field is left with its new value, which we step back to get the old one
+	if postfix {
+		c.emit(stepBack)
+	}
+	return nil
+}
+
+// Compile the right side of an assignment. For a compound assignment like x += 1
+// the current value of the target is already on the stack, and gets combined with it
+func (c *Compiler) compileAssignedValue(node *ast.Assignment) error {
+	err := c.Compile(node.Value)
+	if err != nil {
+		return err
+	}
+
+	if node.Operator == "" {
+		return nil
+	}
+	// The position of the assignment, not of its right side
+	return c.emitOperator(node.Operator)
+}
+
 // Re-create the instruction with the new operand
 // assuming we only replace instructions of the same type
 func (c *Compiler) changeOperand(opPos int, operand int) {
@@ -498,11 +1013,230 @@ func (c *Compiler) leaveScope() code.Instructions {
 	return instructions
 }
 
+func (c *Compiler) enterLoop() {
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = append(scope.loops, &LoopContext{tries: scope.tries})
+}
+
+func (c *Compiler) leaveLoop() *LoopContext {
+	scope := &c.scopes[c.scopeIndex]
+	loop := scope.loops[len(scope.loops)-1]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+	return loop
+}
+
+// Return the innermost loop of the current scope, or nil if we are not inside one
+func (c *Compiler) currentLoop() *LoopContext {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil
+	}
+	return loops[len(loops)-1]
+}
+
+// Remove the error handlers of the try blocks that break/continue jumps out of
+func (c *Compiler) leaveTries(loop *LoopContext) {
+	for range c.scopes[c.scopeIndex].tries - loop.tries {
+		c.emit(code.OpEndTry)
+	}
+}
+
+// Point the jumps emitted by break and continue statements to their targets
+func (c *Compiler) patchLoopJumps(loop *LoopContext, continuePos, breakPos int) {
+	for _, pos := range loop.continuePositions {
+		c.changeOperand(pos, continuePos)
+	}
+	for _, pos := range loop.breakPositions {
+		c.changeOperand(pos, breakPos)
+	}
+}
+
 func (c *Compiler) replaceLastPopWithReturn() {
 	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
 	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
 
 	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+
+	// The implicit return of a call, e.g. funk(n) { loop(n - 1) }
+	previous := c.scopes[c.scopeIndex].previousInstruction
+	for _, pos := range c.callsEndingAt(previous, lastPos) {
+		c.makeTailCall(pos)
+	}
+}
+
+// Return the positions of the calls whose result is the value of the code compiled so far.
+// That is the last instruction if it is a call, or the calls ending the branches of an if or ternary
+func (c *Compiler) endingCalls() []int {
+	return c.callsEndingAt(c.scopes[c.scopeIndex].lastInstruction, len(c.currentInstructions()))
+}
+
+// Like endingCalls, for the code up to end, with last as the instruction right before it
+func (c *Compiler) callsEndingAt(last EmittedInstruction, end int) []int {
+	scope := c.scopes[c.scopeIndex]
+	// Checked first, since the call ending the last branch is among them
+	if scope.branchesEnd == end {
+		return scope.branchCalls
+	}
+	if last.Opcode == code.OpCall && last.Position+2 == end {
+		return []int{last.Position}
+	}
+	return nil
+}
+
+// Remember the calls ending the branches of the if or ternary expression that ends at end
+func (c *Compiler) setBranchCalls(calls []int, end int) {
+	c.scopes[c.scopeIndex].branchCalls = calls
+	c.scopes[c.scopeIndex].branchesEnd = end
+}
+
+// Turn the call at pos, which is followed by a return, into a tail call,
+// so the VM can reuse the frame of the function we are compiling for the callee.
+// Recursion in tail position then runs in constant stack space.
+// The main program has no caller to return to, and a call in a try block
+// has to come back for its errors to be caught, so they keep a normal call
+func (c *Compiler) makeTailCall(pos int) {
+	if c.scopeIndex == 0 || c.scopes[c.scopeIndex].tries > 0 {
+		return
+	}
+
+	ins := c.currentInstructions()
+	ins[pos] = byte(code.OpTailCall)
+}
+
+// Compile && and || so the right operand only runs when the left one does not decide the result.
+// Either way a boolean is left on the stack, the same as in the evaluator:
+//
+//	a && b                       a || b
+//	<a>                          <a>
+//	OpJumpNotTruthy false        OpJumpNotTruthy right
+//	<b>                          OpTrue
+//	OpJumpNotTruthy false        OpJump end
+//	OpTrue                 right: <b>
+//	OpJump end                   OpJumpNotTruthy false
+//	false: OpFalse               OpTrue
+//	end:                         OpJump end
+//	                             false: OpFalse
+//	                             end:
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	err := c.Compile(node.Left)
+	if err != nil {
+		return err
+	}
+
+	jumpToFalse := []int{}
+	jumpToEnd := []int{}
+
+	leftPos := c.emit(code.OpJumpNotTruthy, 9999)
+	if node.Operator == "&&" {
+		jumpToFalse = append(jumpToFalse, leftPos)
+	} else {
+		c.emit(code.OpTrue)
+		jumpToEnd = append(jumpToEnd, c.emit(code.OpJump, 9999))
+		c.changeOperand(leftPos, len(c.currentInstructions()))
+	}
+
+	err = c.Compile(node.Right)
+	if err != nil {
+		return err
+	}
+
+	jumpToFalse = append(jumpToFalse, c.emit(code.OpJumpNotTruthy, 9999))
+	c.emit(code.OpTrue)
+	jumpToEnd = append(jumpToEnd, c.emit(code.OpJump, 9999))
+
+	falsePos := c.emit(code.OpFalse)
+	for _, pos := range jumpToFalse {
+		c.changeOperand(pos, falsePos)
+	}
+
+	endPos := len(c.currentInstructions())
+	for _, pos := range jumpToEnd {
+		c.changeOperand(pos, endPos)
+	}
+
+	return nil
+}
+
+// Resolve the symbol an assignment writes to.
+// Builtins and the name of the function being compiled cannot be reassigned
+func (c *Compiler) resolveAssignable(ident *ast.Identifier) (Symbol, error) {
+	symbol, ok := c.symbolTable.Resolve(ident.Value)
+	if !ok {
+		return symbol, errorAt(ident.Pos(), "undefined variable %s", ident.Value)
+	}
+
+	switch symbol.Scope {
+	case GlobalScope, LocalScope, FreeScope:
+		return symbol, nil
+	default:
+		return symbol, errorAt(ident.Pos(), "cannot assign to %s", ident.Value)
+	}
+}
+
+// Bind the parts of the value on top of the stack to the names in a pattern
+func (c *Compiler) compilePattern(pattern ast.Pattern) error {
+	// The VM reports values of the wrong shape at the pattern
+	parent := c.position
+	c.position = pattern.Pos()
+	defer func() { c.position = parent }()
+
+	var names []*ast.Identifier
+	switch pattern := pattern.(type) {
+	case *ast.TuplePattern:
+		names = pattern.Names
+		c.emit(code.OpUnpackTuple, len(names))
+	case *ast.ArrayPattern:
+		names = pattern.Names
+		rest := 0
+		if pattern.Rest != nil {
+			names = append(names[:len(names):len(names)], pattern.Rest)
+			rest = 1
+		}
+		c.emit(code.OpUnpackArray, len(pattern.Names), rest)
+	case *ast.HashPattern:
+		names = pattern.Names
+		for _, name := range names {
+			c.emit(code.OpConstant, c.addConstant(&object.String{Value: name.Value}))
+		}
+		c.emit(code.OpUnpackHash, len(names))
+	default:
+		return errorAt(pattern.Pos(), "unknown pattern %s", pattern)
+	}
+
+	symbols := make([]Symbol, len(names))
+	for i, name := range names {
+		symbols[i] = c.symbolTable.Define(name.Value)
+	}
+	// The last part is on top of the stack
+	for i := len(symbols) - 1; i >= 0; i-- {
+		c.storeSymbol(symbols[i])
+	}
+
+	return nil
+}
+
+// Pop the value on top of the stack into the binding of the symbol
+func (c *Compiler) storeSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpSetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpSetFree, s.Index)
+	}
+}
+
+// Load the cell holding a variable captured by a closure, rather than its value
+func (c *Compiler) loadCell(s Symbol) {
+	switch s.Scope {
+	case LocalScope:
+		c.emit(code.OpGetLocalCell, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFreeCell, s.Index)
+	default:
+		c.loadSymbols(s)
+	}
 }
 
 func (c *Compiler) loadSymbols(s Symbol) {
@@ -519,3 +1253,12 @@ func (c *Compiler) loadSymbols(s Symbol) {
 		c.emit(code.OpCurrentClosure)
 	}
 }
+
+// Create a compiler error pointing at the given source position
+func errorAt(pos token.Position, format string, a ...any) error {
+	msg := fmt.Sprintf(format, a...)
+	if !pos.IsValid() {
+		return fmt.Errorf("%s", msg)
+	}
+	return fmt.Errorf("%s: %s", pos, msg)
+}
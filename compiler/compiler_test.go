@@ -71,6 +71,16 @@ func TestIntegerArithmetic(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			input:             "7 % 3",
+			expectedConstants: []any{7, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMod),
+				code.Make(code.OpPop),
+			},
+		},
 		{
 			input:             "5 | 5",
 			expectedConstants: []any{5, 5},
@@ -155,39 +165,30 @@ func TestIntegerArithmetic(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	tests := []compilerTestCase{
 		{
-			input:             "++5",
-			expectedConstants: []any{5},
-			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpPreInc),
-				code.Make(code.OpPop),
-			},
-		},
-		{
-			input:             "--5",
-			expectedConstants: []any{5},
-			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpPreDec),
-				code.Make(code.OpPop),
-			},
-		},
-		{
-			input:             "5++",
-			expectedConstants: []any{5},
+			input: "1.5 + 2",
+			// Float literals are rounded at compile time
+			expectedConstants: []any{1.5, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
-				code.Make(code.OpPostInc),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
 				code.Make(code.OpPop),
 			},
 		},
 		{
-			input:             "5--",
-			expectedConstants: []any{5},
+			input:             "-1.23456789",
+			expectedConstants: []any{1.234568},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
-				code.Make(code.OpPostDec),
+				code.Make(code.OpMinus),
 				code.Make(code.OpPop),
 			},
 		},
@@ -234,6 +235,27 @@ func TestBooleanExpressions(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			input:             "1 >= 2",
+			expectedConstants: []any{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpGreaterThanOrEqual),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// Swapped just like <
+			input:             "1 <= 2",
+			expectedConstants: []any{2, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpGreaterThanOrEqual),
+				code.Make(code.OpPop),
+			},
+		},
 		{
 			input:             "1 == 2",
 			expectedConstants: []any{1, 2},
@@ -333,6 +355,177 @@ func TestConditionals(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestLogicalExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "true && false;",
+			expectedConstants: []any{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001 - A falsy left operand decides the result
+				code.Make(code.OpJumpNotTruthy, 12),
+				// 0004
+				code.Make(code.OpFalse),
+				// 0005
+				code.Make(code.OpJumpNotTruthy, 12),
+				// 0008
+				code.Make(code.OpTrue),
+				// 0009
+				code.Make(code.OpJump, 13),
+				// 0012
+				code.Make(code.OpFalse),
+				// 0013
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 || 2;",
+			expectedConstants: []any{1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003 - A falsy left operand moves on to the right one
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0006
+				code.Make(code.OpTrue),
+				// 0007
+				code.Make(code.OpJump, 21),
+				// 0010
+				code.Make(code.OpConstant, 1),
+				// 0013
+				code.Make(code.OpJumpNotTruthy, 20),
+				// 0016
+				code.Make(code.OpTrue),
+				// 0017
+				code.Make(code.OpJump, 21),
+				// 0020
+				code.Make(code.OpFalse),
+				// 0021
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "try { 10 } catch (e) { e }; 3333;",
+			expectedConstants: []any{10, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000 - Install a handler for the catch block
+				code.Make(code.OpTry, 10),
+				// 0003 - Try block
+				code.Make(code.OpConstant, 0),
+				// 0006 - No error, remove the handler
+				code.Make(code.OpEndTry),
+				// 0007 - Skip the catch block
+				code.Make(code.OpJump, 16),
+				// 0010 - Catch block: bind the error
+				code.Make(code.OpSetGlobal, 0),
+				// 0013
+				code.Make(code.OpGetGlobal, 0),
+				// 0016
+				code.Make(code.OpPop),
+				// 0017
+				code.Make(code.OpConstant, 1),
+				// 0020
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "while (true) { try { break; } catch (e) { } }",
+			expectedConstants: []any{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 24),
+				// 0004
+				code.Make(code.OpTry, 16),
+				// 0007 - break leaves the try block, so its handler goes first
+				code.Make(code.OpEndTry),
+				// 0008
+				code.Make(code.OpJump, 24),
+				// 0011
+				code.Make(code.OpNull),
+				// 0012
+				code.Make(code.OpEndTry),
+				// 0013
+				code.Make(code.OpJump, 20),
+				// 0016
+				code.Make(code.OpSetGlobal, 0),
+				// 0019
+				code.Make(code.OpNull),
+				// 0020
+				code.Make(code.OpPop),
+				// 0021
+				code.Make(code.OpJump, 0),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestTernaryExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "true ? 10 : 20; 3333;",
+			expectedConstants: []any{10, 20, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001 - If false move to the alternative
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004 - Consequence
+				code.Make(code.OpConstant, 0),
+				// 0007 - Skip the alternative
+				code.Make(code.OpJump, 13),
+				// 0010 - Alternative
+				code.Make(code.OpConstant, 1),
+				// 0013
+				code.Make(code.OpPop),
+				// 0014
+				code.Make(code.OpConstant, 2),
+				// 0017
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "true ? (false ? 10 : 20) : 30;",
+			expectedConstants: []any{10, 20, 30},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 20),
+				// 0004 - Nested ternary
+				code.Make(code.OpFalse),
+				// 0005
+				code.Make(code.OpJumpNotTruthy, 14),
+				// 0008
+				code.Make(code.OpConstant, 0),
+				// 0011
+				code.Make(code.OpJump, 17),
+				// 0014
+				code.Make(code.OpConstant, 1),
+				// 0017
+				code.Make(code.OpJump, 23),
+				// 0020
+				code.Make(code.OpConstant, 2),
+				// 0023
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestGlobalLetStatements(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -495,6 +688,116 @@ func TestHashLiterals(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestStructs(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "struct Point { x, y }; let p = Point { y: 2 }; p.x = p.y",
+			expectedConstants: []any{
+				&object.StructType{Name: "Point", Fields: []string{"x", "y"}},
+				"y",
+				2,
+				"y",
+				"x",
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpStruct, 1),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpGetField, 3),
+				code.Make(code.OpSetField, 4),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestTuples(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let (a, b) = (1, 2); b",
+			expectedConstants: []any{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpTuple, 2),
+				code.Make(code.OpUnpackTuple, 2),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "funk(a) { return a, 1 }",
+			expectedConstants: []any{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpTuple, 2),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `let [a, ...rest] = [1]; let {k} = rest;`,
+			expectedConstants: []any{1, "k"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpUnpackArray, 1, 1),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpUnpackHash, 1),
+				code.Make(code.OpSetGlobal, 2),
+			},
+		},
+		{
+			input: "funk([a, b], c = a) { b }",
+			expectedConstants: []any{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpUnpackArray, 2, 0),
+					code.Make(code.OpSetLocal, 3),
+					code.Make(code.OpSetLocal, 2),
+					code.Make(code.OpJumpIfPassed, 18, 1),
+					code.Make(code.OpGetLocal, 2),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 3),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestIndexExpressions(t *testing.T) {
 	// For index-operator expression, we must ensure we can compile both array and hash literals
 	tests := []compilerTestCase{
@@ -594,6 +897,38 @@ func TestFunctions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestDefaultParameters(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `funk(a, b = a * 2, ...rest) { b }`,
+			expectedConstants: []any{
+				2,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpJumpIfPassed, 12, 1),
+					// 0004
+					code.Make(code.OpGetLocal, 0),
+					// 0006
+					code.Make(code.OpConstant, 0),
+					// 0009
+					code.Make(code.OpMul),
+					// 0010
+					code.Make(code.OpSetLocal, 1),
+					// 0012
+					code.Make(code.OpGetLocal, 1),
+					// 0014
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
 func TestFunctionsWithoutReturnValue(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -865,7 +1200,7 @@ push([], 1);
 				[]code.Instructions{
 					code.Make(code.OpGetBuiltin, 0),
 					code.Make(code.OpArray, 0),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturnValue),
 				},
 			},
@@ -900,7 +1235,7 @@ func TestClosures(t *testing.T) {
 					code.Make(code.OpReturnValue),
 				},
 				[]code.Instructions{
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocalCell, 0),
 					// 1 free variable sitting on the stack
 					code.Make(code.OpClosure, 0, 1),
 					code.Make(code.OpReturnValue),
@@ -935,14 +1270,14 @@ func TestClosures(t *testing.T) {
 				},
 				// 2nd closure is function with param b
 				[]code.Instructions{
-					code.Make(code.OpGetFree, 0),
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetFreeCell, 0),
+					code.Make(code.OpGetLocalCell, 0),
 					// Populate the Free array with 2 variables a and b
 					code.Make(code.OpClosure, 0, 2),
 					code.Make(code.OpReturnValue),
 				},
 				[]code.Instructions{
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocalCell, 0),
 					code.Make(code.OpClosure, 1, 1),
 					code.Make(code.OpReturnValue),
 				},
@@ -991,8 +1326,8 @@ func TestClosures(t *testing.T) {
 				[]code.Instructions{
 					code.Make(code.OpConstant, 2),
 					code.Make(code.OpSetLocal, 0),
-					code.Make(code.OpGetFree, 0),
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetFreeCell, 0),
+					code.Make(code.OpGetLocalCell, 0),
 					code.Make(code.OpClosure, 4, 2),
 					code.Make(code.OpReturnValue),
 				},
@@ -1000,7 +1335,7 @@ func TestClosures(t *testing.T) {
 				[]code.Instructions{
 					code.Make(code.OpConstant, 1),
 					code.Make(code.OpSetLocal, 0),
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocalCell, 0),
 					code.Make(code.OpClosure, 5, 1),
 					code.Make(code.OpReturnValue),
 				},
@@ -1036,7 +1371,7 @@ func TestRecursiveFunctions(t *testing.T) {
 					code.Make(code.OpConstant, 0),
 					code.Make(code.OpSub),
 					// countDown call itself
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturnValue),
 				},
 				1,
@@ -1071,7 +1406,7 @@ func TestRecursiveFunctions(t *testing.T) {
 					code.Make(code.OpGetLocal, 0),
 					code.Make(code.OpConstant, 0),
 					code.Make(code.OpSub),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturnValue),
 				},
 				1, // countDown(1)
@@ -1082,7 +1417,7 @@ func TestRecursiveFunctions(t *testing.T) {
 					code.Make(code.OpSetLocal, 0),
 					code.Make(code.OpGetLocal, 0),
 					code.Make(code.OpConstant, 2),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturnValue),
 				},
 			},
@@ -1101,6 +1436,309 @@ func TestRecursiveFunctions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestTailCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `funk(f) { return f(1); }`,
+			expectedConstants: []any{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// The call has to come back for the addition
+			input: `funk(f) { f() + 1 }`,
+			expectedConstants: []any{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCall, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// And for the catch block to see its errors
+			input: `funk(f) { try { return f(); } catch (e) { 0 } }`,
+			expectedConstants: []any{
+				0,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpTry, 12),
+					// 0003
+					code.Make(code.OpGetLocal, 0),
+					// 0005
+					code.Make(code.OpCall, 0),
+					// 0007
+					code.Make(code.OpReturnValue),
+					// 0008
+					code.Make(code.OpEndTry),
+					// 0009
+					code.Make(code.OpJump, 17),
+					// 0012
+					code.Make(code.OpSetLocal, 1),
+					// 0014
+					code.Make(code.OpConstant, 0),
+					// 0017
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// Each branch of an if in tail position is too
+			input: `funk(f, c) { if (c) { f() } else { 0 } }`,
+			expectedConstants: []any{
+				0,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpGetLocal, 1),
+					// 0002
+					code.Make(code.OpJumpNotTruthy, 12),
+					// 0005
+					code.Make(code.OpGetLocal, 0),
+					// 0007
+					code.Make(code.OpTailCall, 0),
+					// 0009
+					code.Make(code.OpJump, 15),
+					// 0012
+					code.Make(code.OpConstant, 0),
+					// 0015
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestAssignments(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let x = 1; x = 2;",
+			expectedConstants: []any{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 0),
+				// The assigned value is the value of the expression
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let x = 1; x++;",
+			expectedConstants: []any{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				// The old value stays on the stack
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPreInc),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let arr = [1]; arr[0] = 2;",
+			expectedConstants: []any{1, 0, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let arr = [1]; arr[0] += 2;",
+			expectedConstants: []any{1, 0, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				// The collection and the index are reused for reading the element
+				code.Make(code.OpDup, 2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let arr = [1]; arr[0]++;",
+			expectedConstants: []any{1, 0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpDup, 2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpPreInc),
+				code.Make(code.OpSetIndex),
+				// The new value stepped back is the old one
+				code.Make(code.OpPreDec),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "funk() { let a = 1; funk() { a = 2; } }",
+			expectedConstants: []any{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpSetFree, 0),
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocalCell, 0),
+					code.Make(code.OpClosure, 2, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestLoops(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `while (true) { 10 }`,
+			expectedConstants: []any{10},
+			expectedInstructions: []code.Instructions{
+				// 0000 - Loop start: evaluate the condition
+				code.Make(code.OpTrue),
+				// 0001 - Leave the loop if the condition does not hold
+				code.Make(code.OpJumpNotTruthy, 11),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpPop),
+				// 0008 - Back to the condition
+				code.Make(code.OpJump, 0),
+			},
+		},
+		{
+			input:             `while (true) { break; continue; }`,
+			expectedConstants: []any{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 13),
+				// 0004 - break jumps past the loop
+				code.Make(code.OpJump, 13),
+				// 0007 - continue jumps back to the condition
+				code.Make(code.OpJump, 0),
+				// 0010
+				code.Make(code.OpJump, 0),
+			},
+		},
+		{
+			input:             `for (let i = 0; i < 1; i = i + 1) { continue; }`,
+			expectedConstants: []any{0, 1, 1},
+			expectedInstructions: []code.Instructions{
+				// 0000 - Init
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpSetGlobal, 0),
+				// 0006 - Loop start: i < 1 is compiled as 1 > i
+				code.Make(code.OpConstant, 1),
+				// 0009
+				code.Make(code.OpGetGlobal, 0),
+				// 0012
+				code.Make(code.OpGreaterThan),
+				// 0013
+				code.Make(code.OpJumpNotTruthy, 36),
+				// 0016 - continue jumps to the update expression
+				code.Make(code.OpJump, 19),
+				// 0019 - Update
+				code.Make(code.OpGetGlobal, 0),
+				// 0022
+				code.Make(code.OpConstant, 2),
+				// 0025
+				code.Make(code.OpAdd),
+				// 0026
+				code.Make(code.OpSetGlobal, 0),
+				// 0029
+				code.Make(code.OpGetGlobal, 0),
+				// 0032
+				code.Make(code.OpPop),
+				// 0033
+				code.Make(code.OpJump, 6),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break;", "1:1: break outside of loop"},
+		{"continue;", "1:1: continue outside of loop"},
+		// A function body does not inherit the loop it is defined in
+		{"while (true) { funk() { break; } }", "1:25: break outside of loop"},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		err := compiler.Compile(parse(tt.input))
+		if err == nil {
+			t.Fatalf("expected compiler error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong compiler error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
 func runCompilerTests(t *testing.T, tests []compilerTestCase) {
 	// Without this, the error will be shown in the helper function
 	// Not the test function that invokes this helper method
@@ -1167,6 +1805,12 @@ func testConstants(expected []any, actual []object.Object) error {
 				return fmt.Errorf("constant %d - testIntegerObject failed: %s",
 					i, err)
 			}
+		case float64:
+			err := testFloatObject(constant, actual[i])
+			if err != nil {
+				return fmt.Errorf("constant %d - testFloatObject failed: %s",
+					i, err)
+			}
 		case string:
 			err := testStringObject(constant, actual[i])
 			if err != nil {
@@ -1183,6 +1827,11 @@ func testConstants(expected []any, actual []object.Object) error {
 			if err != nil {
 				return fmt.Errorf("constant %d - testInstrutions failed: %s", i, err)
 			}
+		case *object.StructType:
+			if actual[i].Inspect() != constant.Inspect() {
+				return fmt.Errorf("constant %d - wrong struct type. want=%s, got=%s",
+					i, constant.Inspect(), actual[i].Inspect())
+			}
 		}
 	}
 
@@ -1203,6 +1852,20 @@ func testIntegerObject(expected int64, actual object.Object) error {
 	return nil
 }
 
+func testFloatObject(expected float64, actual object.Object) error {
+	result, ok := actual.(*object.Float)
+	if !ok {
+		return fmt.Errorf("object is not Float. got: %T (%+v)",
+			actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got: %f, want: %f", result.Value, expected)
+	}
+
+	return nil
+}
+
 func testStringObject(expected string, actual object.Object) error {
 	result, ok := actual.(*object.String)
 	if !ok {
@@ -1227,3 +1890,48 @@ func concatInstructions(s []code.Instructions) code.Instructions {
 
 	return out
 }
+
+func TestSourceMap(t *testing.T) {
+	input := `1;
+let f = funk() {
+  2 * 3
+};`
+
+	compiler := New()
+	err := compiler.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := compiler.Bytecode()
+	fn, ok := bytecode.Constants[3].(*object.CompiledFunction)
+	if !ok {
+		t.Fatalf("constant 3 is not CompiledFunction. got=%T", bytecode.Constants[3])
+	}
+
+	tests := []struct {
+		sourceMap      code.SourceMap
+		offset         int
+		expectedLine   int
+		expectedColumn int
+	}{
+		// 0000 OpConstant 0 for `1`
+		{bytecode.SourceMap, 0, 1, 1},
+		// 0003 OpPop
+		{bytecode.SourceMap, 3, 1, 1},
+		// 0004 OpClosure for the function literal
+		{bytecode.SourceMap, 4, 2, 9},
+		// Inside the function: 0000 OpConstant 1 for `2`
+		{fn.SourceMap, 0, 3, 3},
+		// 0006 OpMul for `*`
+		{fn.SourceMap, 6, 3, 5},
+	}
+
+	for i, tt := range tests {
+		pos := tt.sourceMap.Lookup(tt.offset)
+		if pos.Line != tt.expectedLine || pos.Column != tt.expectedColumn {
+			t.Errorf("tests[%d] - wrong position for offset %d. want=%d:%d, got=%s",
+				i, tt.offset, tt.expectedLine, tt.expectedColumn, pos)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package compiler
+
+import (
+	"encoding/binary"
+	"math"
+
+	"s8/ast"
+	"s8/code"
+	"s8/object"
+	"s8/token"
+)
+
+// The optimizations done when Compiler.Optimize is set.
+// None of them change what a program does, only how much work the VM has to do for it
+
+// Compute an expression made of literals at compile time.
+// Report false if it is not constant, or if computing it raises an error,
+// which we leave to the VM so it happens at runtime with a stack trace
+func (c *Compiler) fold(node ast.Expression) (object.Object, bool) {
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: node.Value}, true
+	case *ast.FloatLiteral:
+		return &object.Float{Value: object.ToFixed(node.Value, object.FloatPrecision)}, true
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}, true
+	case *ast.Boolean:
+		if node.Value {
+			return object.TRUE, true
+		}
+		return object.FALSE, true
+	case *ast.PrefixExpression:
+		// ++ and -- need a variable to write to
+		if node.Operator != "-" && node.Operator != "!" && node.Operator != "~" {
+			return nil, false
+		}
+
+		right, ok := c.fold(node.Right)
+		if !ok {
+			return nil, false
+		}
+
+		return foldedValue(object.PrefixOperator(node.Operator, right))
+	case *ast.InfixExpression:
+		left, ok := c.fold(node.Left)
+		if !ok {
+			return nil, false
+		}
+		right, ok := c.fold(node.Right)
+		if !ok || !foldable(node.Operator, left, right) {
+			return nil, false
+		}
+
+		return foldedValue(object.InfixOperator(node.Operator, left, right))
+	default:
+		return nil, false
+	}
+}
+
+// The operators in package object support a few operand types the VM doesn't, or treats them differently,
+// so we only fold what both engines agree on
+func foldable(operator string, left, right object.Object) bool {
+	switch {
+	case operator == "&&" || operator == "||":
+		return true
+	case object.IsNumeric(left) && object.IsNumeric(right):
+		return true
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return operator == "+" || operator == "==" || operator == "!="
+	case left.Type() == object.BOOLEAN_OBJ && right.Type() == object.BOOLEAN_OBJ:
+		return operator == "==" || operator == "!="
+	default:
+		return false
+	}
+}
+
+func foldedValue(obj object.Object) (object.Object, bool) {
+	switch obj.(type) {
+	case *object.Integer, *object.Float, *object.String, *object.Boolean:
+		return obj, true
+	default:
+		return nil, false
+	}
+}
+
+// Emit the instruction that pushes a folded value
+func (c *Compiler) emitFolded(obj object.Object) {
+	if boolean, ok := obj.(*object.Boolean); ok {
+		if boolean.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+		return
+	}
+
+	c.emit(code.OpConstant, c.addConstant(obj))
+}
+
+// Identifies constants with the same type and value, so the pool holds each of them only once
+type constantKey struct {
+	Type  object.ObjectType
+	Value any
+}
+
+func newConstantKey(obj object.Object) (constantKey, bool) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return constantKey{obj.Type(), obj.Value}, true
+	case *object.Float:
+		// Compare the bits, so 0.0 and -0.0 stay apart
+		return constantKey{obj.Type(), math.Float64bits(obj.Value)}, true
+	case *object.String:
+		return constantKey{obj.Type(), obj.Value}, true
+	default:
+		return constantKey{}, false
+	}
+}
+
+// Statements after these in a block can never run
+func isTerminal(stmt ast.Statement) bool {
+	switch stmt.(type) {
+	case *ast.ReturnStatement, *ast.BreakStatement, *ast.ContinueStatement:
+		return true
+	default:
+		return false
+	}
+}
+
+// Point jumps that land on another jump straight at the final target.
+// Nested ifs and loops produce these a lot, e.g. the end of an inner if
+// jumping to the jump at the end of the outer one.
+// The instructions keep their sizes, so nothing else has to move
+func threadJumps(ins code.Instructions) {
+	for i := 0; i < len(ins); {
+		op := code.Opcode(ins[i])
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return
+		}
+
+		if op == code.OpJump || op == code.OpJumpNotTruthy {
+			target := int(code.ReadUint16(ins[i+1:]))
+			final := jumpDestination(ins, target)
+			if final != target {
+				copy(ins[i:], code.Make(op, final))
+			}
+		}
+
+		i += 1 + def.Width()
+	}
+}
+
+// Follow a chain of unconditional jumps to where it ends
+func jumpDestination(ins code.Instructions, target int) int {
+	// A chain longer than the number of instructions is a loop that never ends,
+	// any jump in it is as good as another
+	for range len(ins) {
+		if target >= len(ins) || code.Opcode(ins[target]) != code.OpJump {
+			return target
+		}
+		target = int(code.ReadUint16(ins[target+1:]))
+	}
+	return target
+}
+
+// Replace a local and a constant combined by a binary operator, e.g. n - 1 or x == 0,
+// with a superinstruction that does all of it in one step of the VM.
+// The superinstructions are shorter than the sequences they replace,
+// so the jumps and the source map are moved along with the instructions
+func fuseInstructions(ins code.Instructions, sourceMap code.SourceMap) (code.Instructions, code.SourceMap) {
+	targets := jumpTargets(ins)
+
+	var fused code.Instructions
+	var fusedMap code.SourceMap
+	// Where each instruction ended up, for relocating the jumps
+	offsets := map[int]int{}
+
+	for i := 0; i < len(ins); {
+		offsets[i] = len(fused)
+
+		instruction, width, operator := fuse(ins, i, targets)
+		if instruction == nil {
+			def, err := code.Lookup(ins[i])
+			if err != nil {
+				return ins, sourceMap
+			}
+			width = 1 + def.Width()
+			instruction = ins[i : i+width]
+			operator = i
+		}
+
+		// Errors in a superinstruction come from its operator
+		if pos := sourceMap.Lookup(operator); pos != (token.Position{}) {
+			fusedMap.Add(len(fused), pos)
+		}
+		fused = append(fused, instruction...)
+		i += width
+	}
+	offsets[len(ins)] = len(fused)
+
+	for i := 0; i < len(fused); {
+		op := code.Opcode(fused[i])
+		def, _ := code.Lookup(fused[i])
+
+		if isJump(op) {
+			// The target is always the first operand, leave the others alone
+			target := int(code.ReadUint16(fused[i+1:]))
+			binary.BigEndian.PutUint16(fused[i+1:], uint16(offsets[target]))
+		}
+
+		i += 1 + def.Width()
+	}
+
+	return fused, fusedMap
+}
+
+// Return the superinstruction for the sequence starting at offset i, if there is one,
+// with the width of the sequence and the offset of its operator.
+// Nothing may jump into the middle of a sequence
+func fuse(ins code.Instructions, i int, targets map[int]bool) (code.Instructions, int, int) {
+	var second int
+	switch code.Opcode(ins[i]) {
+	case code.OpGetLocal:
+		second = i + 2
+	case code.OpConstant:
+		second = i + 3
+	default:
+		return nil, 0, 0
+	}
+
+	// Either way the operator comes 5 bytes in
+	operator := i + 5
+	if operator >= len(ins) || targets[second] || targets[operator] {
+		return nil, 0, 0
+	}
+	op := code.Opcode(ins[operator])
+	if !isFusable(op) {
+		return nil, 0, 0
+	}
+
+	switch {
+	case code.Opcode(ins[i]) == code.OpGetLocal && code.Opcode(ins[second]) == code.OpConstant:
+		local := int(code.ReadUint8(ins[i+1:]))
+		constant := int(code.ReadUint16(ins[second+1:]))
+		return code.Make(code.OpBinaryLocalConstant, int(op), local, constant), 6, operator
+	case code.Opcode(ins[i]) == code.OpConstant && code.Opcode(ins[second]) == code.OpGetLocal:
+		constant := int(code.ReadUint16(ins[i+1:]))
+		local := int(code.ReadUint8(ins[second+1:]))
+		return code.Make(code.OpBinaryConstantLocal, int(op), constant, local), 6, operator
+	default:
+		return nil, 0, 0
+	}
+}
+
+// The binary operators and comparisons the superinstructions can do
+func isFusable(op code.Opcode) bool {
+	switch op {
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+		code.OpPipe, code.OpRShift, code.OpLShift, code.OpAmpersand, code.OpExponent,
+		code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterThanOrEqual:
+		return true
+	default:
+		return false
+	}
+}
+
+func isJump(op code.Opcode) bool {
+	return op == code.OpJump || op == code.OpJumpNotTruthy || op == code.OpTry || op == code.OpJumpIfPassed
+}
+
+// Return the offsets the jumps in the instructions land on
+func jumpTargets(ins code.Instructions) map[int]bool {
+	targets := map[int]bool{}
+
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return targets
+		}
+
+		if isJump(code.Opcode(ins[i])) {
+			targets[int(code.ReadUint16(ins[i+1:]))] = true
+		}
+
+		i += 1 + def.Width()
+	}
+
+	return targets
+}
@@ -0,0 +1,225 @@
+package compiler
+
+import (
+	"testing"
+
+	"s8/code"
+)
+
+func TestOptimizations(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// Folded into a single constant
+			input:             "1 + 2 * 3; -(4 - 6);",
+			expectedConstants: []any{7, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `1.5 * 2; "s" + "8"; 1 < 2 && !true;`,
+			expectedConstants: []any{3.0, "s8"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpFalse),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// Only the constant part of an expression is folded,
+			// and errors are left for the VM to raise
+			input:             "let x = 1; x * (2 + 3); 1 / 0;",
+			expectedConstants: []any{1, 5, 0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMul),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpDiv),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// Each constant is in the pool once
+			input:             `[1, "a", 1, "a", 2.5, 2.5]`,
+			expectedConstants: []any{1, "a", 2.5},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpArray, 6),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// Nothing after a break can run
+			input:             "while (true) { break; 1; }",
+			expectedConstants: []any{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpJump, 10),
+				// 0007
+				code.Make(code.OpJump, 0),
+			},
+		},
+		{
+			// The end of the inner if jumps straight past the outer one,
+			// instead of to the outer jump
+			input:             "if (true) { if (false) { 1 } else { 2 } } else { 3 }",
+			expectedConstants: []any{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 20),
+				// 0004
+				code.Make(code.OpFalse),
+				// 0005
+				code.Make(code.OpJumpNotTruthy, 14),
+				// 0008
+				code.Make(code.OpConstant, 0),
+				// 0011 - Was OpJump 17, the outer jump to 23
+				code.Make(code.OpJump, 23),
+				// 0014
+				code.Make(code.OpConstant, 1),
+				// 0017
+				code.Make(code.OpJump, 23),
+				// 0020
+				code.Make(code.OpConstant, 2),
+				// 0023
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runOptimizedCompilerTests(t, tests)
+}
+
+func TestOptimizedFunctions(t *testing.T) {
+	input := "funk(x) { return x + (1 + 1); x; }"
+
+	compiler := New()
+	compiler.Optimize = true
+
+	err := compiler.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	expected := []any{
+		2,
+		[]code.Instructions{
+			code.Make(code.OpBinaryLocalConstant, int(code.OpAdd), 0, 0),
+			code.Make(code.OpReturnValue),
+		},
+	}
+
+	err = testConstants(expected, compiler.Bytecode().Constants)
+	if err != nil {
+		t.Fatalf("testConstants failed: %s", err)
+	}
+}
+
+func TestSuperinstructions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "funk(x) { if (x == 0) { 1 } else { 1 - x } }",
+			expectedConstants: []any{
+				0,
+				1,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpBinaryLocalConstant, int(code.OpEqual), 0, 0),
+					// 0005 - The jumps move with the instructions
+					code.Make(code.OpJumpNotTruthy, 14),
+					// 0008
+					code.Make(code.OpConstant, 1),
+					// 0011
+					code.Make(code.OpJump, 19),
+					// 0014
+					code.Make(code.OpBinaryConstantLocal, int(code.OpSub), 1, 0),
+					// 0019
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// Both branches end where the constant is loaded, so it can't be fused
+			input: "funk(c, x) { (c ? 1 : x) - 1 }",
+			expectedConstants: []any{
+				1,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpGetLocal, 0),
+					// 0002
+					code.Make(code.OpJumpNotTruthy, 11),
+					// 0005
+					code.Make(code.OpConstant, 0),
+					// 0008
+					code.Make(code.OpJump, 13),
+					// 0011
+					code.Make(code.OpGetLocal, 1),
+					// 0013
+					code.Make(code.OpConstant, 0),
+					// 0016
+					code.Make(code.OpSub),
+					// 0017
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runOptimizedCompilerTests(t, tests)
+}
+
+func runOptimizedCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		compiler := New()
+		compiler.Optimize = true
+
+		err := compiler.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+
+		err = testInstructions(tt.expectedInstructions, bytecode.Instructions)
+		if err != nil {
+			t.Fatalf("%q: testInstructions failed: %s", tt.input, err)
+		}
+
+		err = testConstants(tt.expectedConstants, bytecode.Constants)
+		if err != nil {
+			t.Fatalf("%q: testConstants failed: %s", tt.input, err)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+
+	"s8/code"
+	"s8/object"
+	"s8/token"
+)
+
+// Compiled programs are saved to .s8c files that look like this:
+//
+//	magic "s8c\x00" | version (uint16) | instructions | source map | constants | CRC-32 of everything before it
+//
+// All numbers are big endian, like the operands in code.Instructions.
+// Byte slices and strings are prefixed with their length as a uint32.
+const bytecodeMagic = "s8c\x00"
+
+// Bump whenever the file layout or the numbering of the opcodes changes,
+// so old files are rejected instead of running the wrong instructions
+const BytecodeVersion = 9
+
+// Tags of the values in the constant pool
+const (
+	tagInteger byte = iota + 1
+	tagFloat
+	tagString
+	tagCompiledFunction
+	tagStructType
+)
+
+// Write the bytecode in the .s8c format
+func (b *Bytecode) Encode(w io.Writer) error {
+	e := &encoder{}
+
+	e.buf.WriteString(bytecodeMagic)
+	e.uint16(BytecodeVersion)
+	e.bytes(b.Instructions)
+	e.sourceMap(b.SourceMap)
+
+	e.uint32(uint32(len(b.Constants)))
+	for _, constant := range b.Constants {
+		err := e.constant(constant)
+		if err != nil {
+			return err
+		}
+	}
+
+	e.uint32(crc32.ChecksumIEEE(e.buf.Bytes()))
+
+	_, err := w.Write(e.buf.Bytes())
+	return err
+}
+
+// Read bytecode written by Encode,
+// rejecting files from other versions and files that are corrupt
+func Decode(r io.Reader) (*Bytecode, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	header := len(bytecodeMagic) + 2
+	if len(data) < header || string(data[:len(bytecodeMagic)]) != bytecodeMagic {
+		return nil, fmt.Errorf("not an s8 bytecode file")
+	}
+
+	version := binary.BigEndian.Uint16(data[len(bytecodeMagic):])
+	if version != BytecodeVersion {
+		return nil, fmt.Errorf("unsupported bytecode version %d, want %d", version, BytecodeVersion)
+	}
+
+	if len(data) < header+4 {
+		return nil, corruptError("unexpected end of data")
+	}
+	body, checksum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != checksum {
+		return nil, corruptError("checksum mismatch")
+	}
+
+	d := &decoder{data: body, pos: header}
+	bytecode := &Bytecode{
+		Instructions: d.instructions(),
+		SourceMap:    d.sourceMap(),
+	}
+
+	numConstants := d.uint32()
+	for i := uint32(0); i < numConstants && d.err == nil; i++ {
+		bytecode.Constants = append(bytecode.Constants, d.constant())
+	}
+
+	if d.err == nil && d.pos != len(d.data) {
+		d.fail("unexpected data after the constant pool")
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	return bytecode, nil
+}
+
+func corruptError(format string, a ...any) error {
+	return fmt.Errorf("corrupt bytecode file: "+format, a...)
+}
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) uint16(n uint16) {
+	e.buf.Write(binary.BigEndian.AppendUint16(nil, n))
+}
+
+func (e *encoder) uint32(n uint32) {
+	e.buf.Write(binary.BigEndian.AppendUint32(nil, n))
+}
+
+func (e *encoder) uint64(n uint64) {
+	e.buf.Write(binary.BigEndian.AppendUint64(nil, n))
+}
+
+func (e *encoder) boolean(b bool) {
+	if b {
+		e.buf.WriteByte(1)
+	} else {
+		e.buf.WriteByte(0)
+	}
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uint32(uint32(len(b)))
+	e.buf.Write(b)
+}
+
+func (e *encoder) string(s string) {
+	e.bytes([]byte(s))
+}
+
+func (e *encoder) sourceMap(sm code.SourceMap) {
+	e.uint32(uint32(len(sm.Offsets)))
+	for i, offset := range sm.Offsets {
+		pos := sm.Positions[i]
+		e.uint32(uint32(offset))
+		e.string(pos.Filename)
+		e.uint32(uint32(pos.Line))
+		e.uint32(uint32(pos.Column))
+	}
+}
+
+func (e *encoder) constant(obj object.Object) error {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		e.buf.WriteByte(tagInteger)
+		e.uint64(uint64(obj.Value))
+	case *object.Float:
+		e.buf.WriteByte(tagFloat)
+		e.uint64(math.Float64bits(obj.Value))
+	case *object.String:
+		e.buf.WriteByte(tagString)
+		e.string(obj.Value)
+	case *object.CompiledFunction:
+		e.buf.WriteByte(tagCompiledFunction)
+		e.bytes(obj.Instructions)
+		e.uint32(uint32(obj.NumLocals))
+		e.uint32(uint32(obj.NumParameters))
+		e.uint32(uint32(obj.NumDefaults))
+		e.boolean(obj.Variadic)
+		e.string(obj.Name)
+		e.sourceMap(obj.SourceMap)
+	case *object.StructType:
+		e.buf.WriteByte(tagStructType)
+		e.string(obj.Name)
+		e.uint32(uint32(len(obj.Fields)))
+		for _, field := range obj.Fields {
+			e.string(field)
+		}
+	default:
+		return fmt.Errorf("cannot serialize constant of type %s", obj.Type())
+	}
+	return nil
+}
+
+// Reads values off data until the first error,
+// after which every read returns a zero value
+type decoder struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (d *decoder) fail(format string, a ...any) {
+	if d.err == nil {
+		d.err = corruptError(format, a...)
+	}
+}
+
+// Return the next n bytes, or nil if there are not enough left
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.data)-d.pos {
+		d.fail("unexpected end of data")
+		return nil
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b
+}
+
+func (d *decoder) byte() byte {
+	b := d.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (d *decoder) boolean() bool {
+	switch b := d.byte(); b {
+	case 0:
+		return false
+	case 1:
+		return true
+	default:
+		d.fail("invalid boolean %d", b)
+		return false
+	}
+}
+
+func (d *decoder) uint32() uint32 {
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (d *decoder) uint64() uint64 {
+	b := d.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.uint32()
+	b := d.next(int(n))
+	// Copy, so the bytecode does not keep the whole file alive
+	return append([]byte{}, b...)
+}
+
+func (d *decoder) string() string {
+	return string(d.next(int(d.uint32())))
+}
+
+// Read instructions and make sure the VM can step through them
+func (d *decoder) instructions() code.Instructions {
+	ins := code.Instructions(d.bytes())
+
+	for i := 0; i < len(ins) && d.err == nil; {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			d.fail("%s at offset %d", err, i)
+			break
+		}
+
+		width := 1 + def.Width()
+		if i+width > len(ins) {
+			d.fail("truncated %s at offset %d", def.Name, i)
+			break
+		}
+		i += width
+	}
+
+	return ins
+}
+
+func (d *decoder) sourceMap() code.SourceMap {
+	var sm code.SourceMap
+
+	n := d.uint32()
+	for i := uint32(0); i < n && d.err == nil; i++ {
+		offset := int(d.uint32())
+		pos := token.Position{Filename: d.string()}
+		pos.Line = int(d.uint32())
+		pos.Column = int(d.uint32())
+
+		sm.Offsets = append(sm.Offsets, offset)
+		sm.Positions = append(sm.Positions, pos)
+	}
+
+	return sm
+}
+
+func (d *decoder) constant() object.Object {
+	switch tag := d.byte(); tag {
+	case tagInteger:
+		return &object.Integer{Value: int64(d.uint64())}
+	case tagFloat:
+		return &object.Float{Value: math.Float64frombits(d.uint64())}
+	case tagString:
+		return &object.String{Value: d.string()}
+	case tagCompiledFunction:
+		fn := &object.CompiledFunction{Instructions: d.instructions()}
+		fn.NumLocals = int(d.uint32())
+		fn.NumParameters = int(d.uint32())
+		fn.NumDefaults = int(d.uint32())
+		fn.Variadic = d.boolean()
+		fn.Name = d.string()
+		fn.SourceMap = d.sourceMap()
+		return fn
+	case tagStructType:
+		st := &object.StructType{Name: d.string(), Fields: []string{}}
+		n := d.uint32()
+		for i := uint32(0); i < n && d.err == nil; i++ {
+			st.Fields = append(st.Fields, d.string())
+		}
+		return st
+	default:
+		d.fail("unknown constant tag %d", tag)
+		return nil
+	}
+}
@@ -0,0 +1,190 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"testing"
+
+	"s8/code"
+	"s8/object"
+)
+
+func TestBytecodeRoundTrip(t *testing.T) {
+	input := `
+	let pi = 3.14;
+	let greet = funk(name) { let greeting = "héllo "; greeting + name };
+	let add = funk(a, b) { funk(c) { a + b + c } };
+	let sum = funk(a, b = 2, ...rest) { a + b + len(rest) };
+	struct Point { x, y }
+	let first = funk([a, ...rest], {name}) { a };
+	[greet("s8"), add(1, -2)(3), pi, sum(1), Point { x: 1 }.x, first([1], {"name": 2})]
+	`
+
+	comp := New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+
+	var buf bytes.Buffer
+	err = bytecode.Encode(&buf)
+	if err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+
+	if decoded.Instructions.String() != bytecode.Instructions.String() {
+		t.Errorf("wrong instructions.\nwant=%q\ngot=%q",
+			bytecode.Instructions.String(), decoded.Instructions.String())
+	}
+	testSourceMap(t, decoded.SourceMap, bytecode.SourceMap)
+
+	if len(decoded.Constants) != len(bytecode.Constants) {
+		t.Fatalf("wrong number of constants. want=%d, got=%d",
+			len(bytecode.Constants), len(decoded.Constants))
+	}
+
+	for i, want := range bytecode.Constants {
+		got := decoded.Constants[i]
+		if got.Type() != want.Type() {
+			t.Errorf("constant %d has wrong type. want=%s, got=%s", i, want.Type(), got.Type())
+			continue
+		}
+
+		wantFn, ok := want.(*object.CompiledFunction)
+		if !ok {
+			if got.Inspect() != want.Inspect() {
+				t.Errorf("constant %d has wrong value. want=%s, got=%s", i, want.Inspect(), got.Inspect())
+			}
+			continue
+		}
+
+		gotFn := got.(*object.CompiledFunction)
+		if gotFn.Instructions.String() != wantFn.Instructions.String() {
+			t.Errorf("constant %d has wrong instructions.\nwant=%q\ngot=%q",
+				i, wantFn.Instructions.String(), gotFn.Instructions.String())
+		}
+		if gotFn.NumLocals != wantFn.NumLocals || gotFn.NumParameters != wantFn.NumParameters {
+			t.Errorf("constant %d has wrong locals/parameters. want=%d/%d, got=%d/%d", i,
+				wantFn.NumLocals, wantFn.NumParameters, gotFn.NumLocals, gotFn.NumParameters)
+		}
+		if gotFn.NumDefaults != wantFn.NumDefaults || gotFn.Variadic != wantFn.Variadic {
+			t.Errorf("constant %d has wrong defaults/variadic. want=%d/%t, got=%d/%t", i,
+				wantFn.NumDefaults, wantFn.Variadic, gotFn.NumDefaults, gotFn.Variadic)
+		}
+		if gotFn.Name != wantFn.Name {
+			t.Errorf("constant %d has wrong name. want=%q, got=%q", i, wantFn.Name, gotFn.Name)
+		}
+		testSourceMap(t, gotFn.SourceMap, wantFn.SourceMap)
+	}
+}
+
+func testSourceMap(t *testing.T, got, want code.SourceMap) {
+	t.Helper()
+
+	if len(got.Offsets) != len(want.Offsets) {
+		t.Fatalf("wrong source map length. want=%d, got=%d", len(want.Offsets), len(got.Offsets))
+	}
+	for i := range want.Offsets {
+		if got.Offsets[i] != want.Offsets[i] || got.Positions[i] != want.Positions[i] {
+			t.Errorf("wrong source map entry %d. want=%d %s, got=%d %s", i,
+				want.Offsets[i], want.Positions[i], got.Offsets[i], got.Positions[i])
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	comp := New()
+	err := comp.Compile(parse(`let f = funk(x) { x * 2 }; f(21)`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var buf bytes.Buffer
+	err = comp.Bytecode().Encode(&buf)
+	if err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+	valid := buf.Bytes()
+
+	// Patch a copy of the file and fix up its checksum,
+	// so only the patched part is wrong
+	patched := func(patch func(data []byte) []byte) []byte {
+		data := patch(append([]byte{}, valid[:len(valid)-4]...))
+		return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"empty", []byte{}, "not an s8 bytecode file"},
+		{"source code", []byte("let x = 1;"), "not an s8 bytecode file"},
+		{
+			"other version",
+			patched(func(data []byte) []byte {
+				binary.BigEndian.PutUint16(data[4:], BytecodeVersion+1)
+				return data
+			}),
+			fmt.Sprintf("unsupported bytecode version %d, want %d", BytecodeVersion+1, BytecodeVersion),
+		},
+		{
+			"flipped bit",
+			func() []byte {
+				data := append([]byte{}, valid...)
+				data[len(data)/2] ^= 0x10
+				return data
+			}(),
+			"corrupt bytecode file: checksum mismatch",
+		},
+		{"truncated", valid[:len(valid)-7], "corrupt bytecode file: checksum mismatch"},
+		{
+			"truncated before checksum",
+			patched(func(data []byte) []byte { return data[:len(data)-3] }),
+			"corrupt bytecode file: unexpected end of data",
+		},
+		{
+			"trailing data",
+			patched(func(data []byte) []byte { return append(data, 0) }),
+			"corrupt bytecode file: unexpected data after the constant pool",
+		},
+		{
+			"unknown opcode",
+			patched(func(data []byte) []byte {
+				// The first byte of the main instructions
+				data[10] = 255
+				return data
+			}),
+			"corrupt bytecode file: opcode 255 undefined at offset 0",
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := Decode(bytes.NewReader(tt.data))
+		if err == nil {
+			t.Errorf("%s: expected error but got none", tt.name)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%q", tt.name, tt.expected, err)
+		}
+	}
+}
+
+func TestEncodeUnsupportedConstant(t *testing.T) {
+	bytecode := &Bytecode{Constants: []object.Object{&object.Boolean{Value: true}}}
+
+	err := bytecode.Encode(&bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "cannot serialize constant of type BOOLEAN") {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
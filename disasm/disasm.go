@@ -0,0 +1,203 @@
+// Package disasm prints compiled programs in a human-readable form
+package disasm
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"s8/code"
+	"s8/compiler"
+	"s8/object"
+)
+
+// Return a listing of the main program followed by every compiled function it creates,
+// outer functions before the functions nested in them.
+// Operands are annotated with what they refer to: constant values, jump labels,
+// builtin names and the free variables captured by closures
+func Disassemble(bytecode *compiler.Bytecode) string {
+	d := &disassembler{constants: bytecode.Constants, listed: map[int]bool{}}
+
+	d.listing("main", bytecode.Instructions)
+	for len(d.pending) > 0 {
+		idx := d.pending[0]
+		d.pending = d.pending[1:]
+		d.function(idx)
+	}
+
+	// Functions no closure is created for, if any
+	for idx, constant := range bytecode.Constants {
+		if _, ok := constant.(*object.CompiledFunction); ok && !d.listed[idx] {
+			d.function(idx)
+		}
+	}
+
+	return d.out.String()
+}
+
+type disassembler struct {
+	out       bytes.Buffer
+	constants []object.Object
+	// Constant indexes of the functions already listed or queued
+	listed  map[int]bool
+	pending []int
+}
+
+func (d *disassembler) function(idx int) {
+	d.listed[idx] = true
+	fn := d.constants[idx].(*object.CompiledFunction)
+
+	d.out.WriteString("\n")
+	header := fmt.Sprintf("%s (parameters: %d, locals: %d)", functionName(idx, fn), fn.NumParameters, fn.NumLocals)
+	d.listing(header, fn.Instructions)
+}
+
+func (d *disassembler) listing(header string, ins code.Instructions) {
+	fmt.Fprintf(&d.out, "== %s ==\n", header)
+
+	labels := jumpLabels(ins)
+
+	i := 0
+	for i < len(ins) {
+		if label, ok := labels[i]; ok {
+			fmt.Fprintf(&d.out, "%s:\n", label)
+		}
+
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&d.out, "%04d ERROR: %s\n", i, err)
+			i++
+			continue
+		}
+		if i+1+def.Width() > len(ins) {
+			fmt.Fprintf(&d.out, "%04d ERROR: %s is missing its operands\n", i, def.Name)
+			return
+		}
+
+		operands, offset := code.ReadOperands(def, ins[i+1:])
+
+		line := fmt.Sprintf("%04d %s", i, def.Name)
+		for _, operand := range operands {
+			line += fmt.Sprintf(" %d", operand)
+		}
+		if comment := d.comment(code.Opcode(ins[i]), operands, labels); comment != "" {
+			line = fmt.Sprintf("%-32s ; %s", line, comment)
+		}
+		d.out.WriteString(line + "\n")
+
+		i += 1 + offset
+	}
+
+	// A jump past the last instruction, e.g. out of a loop at the end of the program
+	if label, ok := labels[len(ins)]; ok {
+		fmt.Fprintf(&d.out, "%s:\n", label)
+	}
+}
+
+// Explain the operands of an instruction
+func (d *disassembler) comment(op code.Opcode, operands []int, labels map[int]string) string {
+	switch op {
+	case code.OpConstant:
+		return d.constant(operands[0])
+	case code.OpJump, code.OpJumpNotTruthy, code.OpTry:
+		return "-> " + labels[operands[0]]
+	case code.OpJumpIfPassed:
+		return fmt.Sprintf("-> %s if parameter %d was passed", labels[operands[0]], operands[1])
+	case code.OpGetField, code.OpSetField:
+		return d.constant(operands[0])
+	case code.OpGetBuiltin:
+		if operands[0] < len(object.Builtins) {
+			return object.Builtins[operands[0]].Name
+		}
+	case code.OpClosure:
+		idx := operands[0]
+		if d.isFunction(idx) && !d.listed[idx] {
+			d.listed[idx] = true
+			d.pending = append(d.pending, idx)
+		}
+		return fmt.Sprintf("%s, %d free", d.constant(idx), operands[1])
+	case code.OpBinaryLocalConstant:
+		return fmt.Sprintf("%s, %s", operatorName(operands[0]), d.constant(operands[2]))
+	case code.OpBinaryConstantLocal:
+		return fmt.Sprintf("%s, %s", operatorName(operands[0]), d.constant(operands[1]))
+	}
+	return ""
+}
+
+// Name the operator of a superinstruction
+func operatorName(op int) string {
+	def, err := code.Lookup(byte(op))
+	if err != nil {
+		return fmt.Sprintf("<opcode %d>", op)
+	}
+	return def.Name
+}
+
+func (d *disassembler) isFunction(idx int) bool {
+	if idx >= len(d.constants) {
+		return false
+	}
+	_, ok := d.constants[idx].(*object.CompiledFunction)
+	return ok
+}
+
+// Show a constant the way it would be written in the source code
+func (d *disassembler) constant(idx int) string {
+	if idx >= len(d.constants) {
+		return "<invalid constant>"
+	}
+
+	switch constant := d.constants[idx].(type) {
+	case *object.String:
+		return fmt.Sprintf("%q", constant.Value)
+	case *object.CompiledFunction:
+		return functionName(idx, constant)
+	default:
+		return constant.Inspect()
+	}
+}
+
+func functionName(idx int, fn *object.CompiledFunction) string {
+	name := fn.Name
+	if name == "" {
+		name = "<anonymous>"
+	}
+	return fmt.Sprintf("fn[%d] %s", idx, name)
+}
+
+// Name the targets of all jumps in the instructions, numbered from the top
+func jumpLabels(ins code.Instructions) map[int]string {
+	var targets []int
+	seen := map[int]bool{}
+
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			i++
+			continue
+		}
+		if i+1+def.Width() > len(ins) {
+			break
+		}
+
+		switch code.Opcode(ins[i]) {
+		case code.OpJump, code.OpJumpNotTruthy, code.OpTry, code.OpJumpIfPassed:
+			target := int(code.ReadUint16(ins[i+1:]))
+			if !seen[target] {
+				seen[target] = true
+				targets = append(targets, target)
+			}
+		}
+
+		i += 1 + def.Width()
+	}
+
+	sort.Ints(targets)
+
+	labels := make(map[int]string, len(targets))
+	for n, target := range targets {
+		labels[target] = fmt.Sprintf("L%d", n+1)
+	}
+
+	return labels
+}
@@ -0,0 +1,118 @@
+package disasm
+
+import (
+	"testing"
+
+	"s8/code"
+	"s8/compiler"
+	"s8/lexer"
+	"s8/object"
+	"s8/parser"
+)
+
+func TestDisassemble(t *testing.T) {
+	input := `
+let add = funk(a) { funk(b) { a + b } };
+while (len("hi") > 1) { break; }
+add(1)(2.5)
+`
+
+	expected := `== main ==
+0000 OpClosure 1 0               ; fn[1] add, 0 free
+0004 OpSetGlobal 0
+L1:
+0007 OpGetBuiltin 0              ; len
+0009 OpConstant 2                ; "hi"
+0012 OpCall 1
+0014 OpConstant 3                ; 1
+0017 OpGreaterThan
+0018 OpJumpNotTruthy 27          ; -> L2
+0021 OpJump 27                   ; -> L2
+0024 OpJump 7                    ; -> L1
+L2:
+0027 OpGetGlobal 0
+0030 OpConstant 4                ; 1
+0033 OpCall 1
+0035 OpConstant 5                ; 2.500000
+0038 OpCall 1
+0040 OpPop
+
+== fn[1] add (parameters: 1, locals: 1) ==
+0000 OpGetLocalCell 0
+0002 OpClosure 0 1               ; fn[0] <anonymous>, 1 free
+0006 OpReturnValue
+
+== fn[0] <anonymous> (parameters: 1, locals: 1) ==
+0000 OpGetFree 0
+0002 OpGetLocal 0
+0004 OpAdd
+0005 OpReturnValue
+`
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	actual := Disassemble(comp.Bytecode())
+	if actual != expected {
+		t.Errorf("wrong listing.\nwant:\n%s\ngot:\n%s", expected, actual)
+	}
+}
+
+func TestDisassembleSuperinstructions(t *testing.T) {
+	input := `funk(n) { n - 1 + 2 * n }`
+
+	expected := `== main ==
+0000 OpClosure 2 0               ; fn[2] <anonymous>, 0 free
+0004 OpPop
+
+== fn[2] <anonymous> (parameters: 1, locals: 1) ==
+0000 OpBinaryLocalConstant 6 0 0 ; OpSub, 1
+0005 OpBinaryConstantLocal 7 1 0 ; OpMul, 2
+0010 OpAdd
+0011 OpReturnValue
+`
+
+	comp := compiler.New()
+	comp.Optimize = true
+	err := comp.Compile(parser.New(lexer.New(input)).ParseProgram())
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	actual := Disassemble(comp.Bytecode())
+	if actual != expected {
+		t.Errorf("wrong listing.\nwant:\n%s\ngot:\n%s", expected, actual)
+	}
+}
+
+func TestDisassembleBadInstructions(t *testing.T) {
+	fn := &object.CompiledFunction{Instructions: code.Make(code.OpReturn)}
+	bytecode := &compiler.Bytecode{
+		Instructions: append(code.Instructions{255}, code.Make(code.OpJump, 4)...),
+		Constants:    []object.Object{fn},
+	}
+
+	// The jump goes past the end, and nothing creates a closure for the function
+	expected := `== main ==
+0000 ERROR: opcode 255 undefined
+0001 OpJump 4                    ; -> L1
+L1:
+
+== fn[0] <anonymous> (parameters: 0, locals: 0) ==
+0000 OpReturn
+`
+
+	actual := Disassemble(bytecode)
+	if actual != expected {
+		t.Errorf("wrong listing.\nwant:\n%s\ngot:\n%s", expected, actual)
+	}
+}
@@ -13,4 +13,6 @@ var builtins = map[string]*object.Builtin{
 	"push":  object.GetBuiltinByName("push"),
 	"puts":  object.GetBuiltinByName("puts"),
 	"power": object.GetBuiltinByName("power"),
+	"error": object.GetBuiltinByName("error"),
+	"keys":  object.GetBuiltinByName("keys"),
 }
@@ -2,7 +2,6 @@ package evaluator
 
 import (
 	"fmt"
-	"math"
 	"s8/ast"
 	"s8/object"
 	"s8/token"
@@ -11,35 +10,51 @@ import (
 // To NOT create new instances of object.Boolean or object.Null and use reference instead
 // This improves performance too (pointer comparison is faster than value comparison)
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
 )
 
-// TODO: Move this somewhere else?
-const epsilon = 0.000001
-const precision = 6
-
 // Traverse the AST recursively
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	result := eval(node, env)
+
+	// Errors bubble up through every node above the one that caused them,
+	// so only the innermost node that knows its position gets to set it
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = node.Pos()
+	}
+
+	return result
+}
+
+func eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.Program:
 		return evalProgram(node, env)
 	case *ast.ExpressionStatement:
 		return Eval(node.Expression, env)
 	case *ast.IntegerLiteral:
-		return &object.Integer{Value: node.Value}
+		return object.NewInteger(node.Value)
 	case *ast.FloatLiteral:
-		return &object.Float{Value: toFixed(node.Value, precision)}
+		return &object.Float{Value: object.ToFixed(node.Value, object.FloatPrecision)}
 	case *ast.Boolean:
-		return nativeBoolToBooleanObj(node.Value)
+		return object.NativeBool(node.Value)
 	case *ast.PrefixExpression:
+		if node.Operator == token.INCREMENT || node.Operator == token.DECREMENT {
+			return evalIncrement(node.Right, node.Operator, false, env)
+		}
+
 		right := Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node, right, env)
+		return object.PrefixOperator(node.Operator, right)
 	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node, env)
+		}
+
 		left := Eval(node.Left, env)
 		if isError(left) {
 			return left
@@ -49,17 +64,23 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		return object.InfixOperator(node.Operator, left, right)
 	case *ast.PostfixExpression:
+		if node.Operator == token.INCREMENT || node.Operator == token.DECREMENT {
+			return evalIncrement(node.Left, node.Operator, true, env)
+		}
+
 		left := Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		return evalPostfixExpression(node, left, env)
+		return newError("unknown operator:%s%s", node.Operator, left.Type())
 	case *ast.BlockStatement:
 		return evalBlockStatement(node, env)
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
 	case *ast.ReturnStatement:
 		val := Eval(node.ReturnValue, env)
 		if isError(val) {
@@ -76,25 +97,14 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return val
 		}
 
+		if node.Pattern != nil {
+			return bindPattern(node.Pattern, val, env)
+		}
+
 		// Bind the value to the identifier
 		env.Set(node.Name.Value, val)
 	case *ast.Assignment:
-		val := Eval(node.Value, env)
-		if isError(val) {
-			return val
-		}
-
-		ident, ok := node.Name.(*ast.Identifier)
-		if !ok {
-			return newError("cannot assign to %T", node.Name)
-		}
-
-		if _, ok := env.Get(ident.Value); !ok {
-			return newError("identifier not found: " + ident.Value)
-		}
-
-		env.Set(ident.Value, val)
-		return val
+		return evalAssignment(node, env)
 	case *ast.WhileStatement:
 		return evalWhileStatement(node, env)
 	case *ast.ForStatement:
@@ -108,7 +118,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		// both happen in the same code block
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return &object.Function{Parameters: params, Defaults: node.Defaults, Rest: node.Rest, Patterns: node.Patterns, Env: env, Body: body}
 	case *ast.CallExpression:
 		if node.Function.TokenLiteral() == "quote" {
 			return quote(node.Arguments[0], env)
@@ -132,7 +142,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(con) {
 			return con
 		}
-		if isTruthy(con) {
+		if object.IsTruthy(con) {
 			return Eval(node.Consequence, env)
 		}
 		return Eval(node.Alternative, env)
@@ -154,6 +164,22 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalIndexExpression(left, index)
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
+	case *ast.TupleLiteral:
+		elements := evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return &object.Tuple{Elements: elements}
+	case *ast.StructStatement:
+		env.Set(node.Name.Value, newStructType(node))
+	case *ast.StructLiteral:
+		return evalStructLiteral(node, env)
+	case *ast.FieldExpression:
+		obj := Eval(node.Object, env)
+		if isError(obj) {
+			return obj
+		}
+		return evalFieldExpression(obj, node.Field.Value)
 	}
 
 	return nil
@@ -202,249 +228,174 @@ func evalBlockStatement(bs *ast.BlockStatement, env *object.Environment) object.
 		// Plus result.Type() would cause a panic if result is nil
 		if result != nil {
 			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ || rt == object.CONTINUE_OBJ {
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ || rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
 				// Still wrap the value inside *object.ReturnValue or *object.Error
 				return result
 			}
 		}
 	}
 
+	// The block is empty or ends with a statement that leaves nothing behind e.g., a let,
+	// so its value is null, like on the VM
+	if result == nil {
+		return NULL
+	}
 	return result
 }
 
-// Take Go's native true and return singleton TRUE pointer
-func nativeBoolToBooleanObj(input bool) *object.Boolean {
-	if input {
-		return TRUE
-	}
+// Step the integer in a variable, an array or hash element or a struct field by one and write it back.
+// The collection and the index are evaluated once, like in compound assignments.
+// Return the new value, or the old one for postfix operators
+func evalIncrement(target ast.Expression, operator string, postfix bool, env *object.Environment) object.Object {
+	var current func() object.Object
+	var store func(object.Object) object.Object
 
-	return FALSE
-}
+	switch target := target.(type) {
+	case *ast.Identifier:
+		current = func() object.Object { return evalIdentifier(target, env) }
+		store = func(val object.Object) object.Object {
+			env.Assign(target.Value, val)
+			return val
+		}
+	case *ast.IndexExpression:
+		left := Eval(target.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := Eval(target.Index, env)
+		if isError(index) {
+			return index
+		}
+
+		current = func() object.Object { return evalIndexExpression(left, index) }
+		store = func(val object.Object) object.Object { return evalIndexAssignment(left, index, val) }
+	case *ast.FieldExpression:
+		obj := Eval(target.Object, env)
+		if isError(obj) {
+			return obj
+		}
 
-func evalPrefixExpression(node *ast.PrefixExpression, right object.Object, env *object.Environment) object.Object {
-	switch node.Operator {
-	case token.BANG:
-		return evalBangOperatorExpression(right)
-	case token.MINUS:
-		return evalMinusPrefixOperatorExpression(right)
-	case token.TILDE:
-		return evalBitwisePrefixNotOperatorExpression(right)
-	case token.INCREMENT, token.DECREMENT:
-		return evalIncreDecrePrefixOperatorExpression(node, right, env)
+		current = func() object.Object { return evalFieldExpression(obj, target.Field.Value) }
+		store = func(val object.Object) object.Object { return evalFieldAssignment(obj, target.Field.Value, val) }
 	default:
-		return newError("unknown operator:%s%s", node.Operator, right.Type())
+		return newError("%s", object.IncrementError(target))
 	}
-}
 
-func evalPostfixExpression(node *ast.PostfixExpression, left object.Object, env *object.Environment) object.Object {
-	if node.Operator == token.INCREMENT || node.Operator == token.DECREMENT {
-		return evalIncreDecrePostfixOperatorExpression(node, left, env)
+	old := current()
+	if isError(old) {
+		return old
 	}
-
-	return newError("unknown operator:%s%s", node.Operator, left.Type())
-}
-
-func evalBangOperatorExpression(right object.Object) object.Object {
-	// If something has the SAME MEMORY ADDRESS value as boolean constants here, then it works
-	switch right {
-	case TRUE:
-		return FALSE
-	case FALSE:
-		return TRUE
-	case NULL:
-		return TRUE
-	default:
-		return FALSE
+	val, ok := old.(*object.Integer)
+	if !ok {
+		return newError("cannot increment non-integer: %s", old.Type())
 	}
-}
 
-func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	switch right.Type() {
-	case object.INTERGER_OBJ:
-		value := right.(*object.Integer).Value
-		return &object.Integer{Value: -value}
-	case object.FLOAT_OBJ:
-		value := right.(*object.Float).Value
-		return &object.Float{Value: -value}
-	default:
-		return newError("unknown operator: -%s", right.Type())
+	newVal := val.Value + 1
+	if operator == token.DECREMENT {
+		newVal = val.Value - 1
 	}
 
-}
-
-func evalBitwisePrefixNotOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTERGER_OBJ {
-		return newError("bitwise operators not supported for type: %s", right.Type())
+	stored := store(object.NewInteger(newVal))
+	if isError(stored) || !postfix {
+		return stored
 	}
-	value := right.(*object.Integer).Value
-
-	return &object.Integer{Value: ^value}
+	return old
 }
 
-func evalIncreDecrePrefixOperatorExpression(node *ast.PrefixExpression, right object.Object, env *object.Environment) object.Object {
-	ident, ok := node.Right.(*ast.Identifier)
+func evalAssignment(node *ast.Assignment, env *object.Environment) object.Object {
+	switch name := node.Name.(type) {
+	case *ast.Identifier:
+		val := assignedValue(node, func() object.Object { return evalIdentifier(name, env) }, env)
+		if isError(val) {
+			return val
+		}
 
-	if !ok {
-		return newError("cannot increment non-identifier: %s", right.Type())
-	}
+		// Write to the environment the variable was defined in,
+		// so functions can update variables of their enclosing environment
+		if _, ok := env.Assign(name.Value, val); !ok {
+			return newError("identifier not found: " + name.Value)
+		}
 
-	val, ok := right.(*object.Integer)
+		return val
+	case *ast.IndexExpression:
+		left := Eval(name.Left, env)
+		if isError(left) {
+			return left
+		}
 
-	if !ok {
-		return newError("cannot increment non-integer: %s", right.Type())
-	}
+		index := Eval(name.Index, env)
+		if isError(index) {
+			return index
+		}
 
-	var newVal int64
-	switch node.Operator {
-	case token.INCREMENT:
-		newVal = val.Value + 1
-	case token.DECREMENT:
-		newVal = val.Value - 1
-	}
+		val := assignedValue(node, func() object.Object { return evalIndexExpression(left, index) }, env)
+		if isError(val) {
+			return val
+		}
 
-	returnVal := &object.Integer{Value: newVal}
-	env.Set(ident.Value, returnVal)
-	return returnVal
-}
+		return evalIndexAssignment(left, index, val)
+	case *ast.FieldExpression:
+		obj := Eval(name.Object, env)
+		if isError(obj) {
+			return obj
+		}
 
-func evalIncreDecrePostfixOperatorExpression(node *ast.PostfixExpression, left object.Object, env *object.Environment) object.Object {
-	ident, ok := node.Left.(*ast.Identifier)
+		val := assignedValue(node, func() object.Object { return evalFieldExpression(obj, name.Field.Value) }, env)
+		if isError(val) {
+			return val
+		}
 
-	if !ok {
-		return newError("cannot increment non-identifier: %s", left.Type())
+		return evalFieldAssignment(obj, name.Field.Value, val)
+	default:
+		// Point at the target rather than the = sign, like the VM does
+		err := newError("cannot assign to %s", node.Name.String())
+		err.Pos = node.Name.Pos()
+		return err
 	}
+}
 
-	val, ok := left.(*object.Integer)
-
-	if !ok {
-		return newError("cannot increment non-integer: %s", left.Type())
+// Return the value an assignment stores. A compound assignment like x += 1 combines
+// the current value of the target with the right side, reading it first like the VM does
+func assignedValue(node *ast.Assignment, current func() object.Object, env *object.Environment) object.Object {
+	if node.Operator == "" {
+		return Eval(node.Value, env)
 	}
 
-	var newVal int64
-	switch node.Operator {
-	case token.INCREMENT:
-		newVal = val.Value + 1
-	case token.DECREMENT:
-		newVal = val.Value - 1
+	left := current()
+	if isError(left) {
+		return left
+	}
+	right := Eval(node.Value, env)
+	if isError(right) {
+		return right
 	}
 
-	originalVal := val.Value
-
-	returnVal := &object.Integer{Value: originalVal}
-	env.Set(ident.Value, &object.Integer{Value: newVal})
-	return returnVal
+	return object.InfixOperator(node.Operator, left, right)
 }
 
-func evalInfixExpression(operator string, left, right object.Object) object.Object {
-	switch {
-	// We cannot use pointer comparison here
-	// Since we are always allocating NEW instances of object.Integer
-	case left.Type() == object.INTERGER_OBJ && right.Type() == object.INTERGER_OBJ:
-		return evalIntegerInfixExpression(operator, left, right)
-	case left.Type() == object.FLOAT_OBJ && right.Type() == object.FLOAT_OBJ:
-		return evalFloatInfixExpression(operator, left, right)
-	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
-		return evalStringInfixExpression(operator, left, right)
-		// For cases like TRUE == TRUE
-		// Here we use POINTER COMPARISON by comparing the memory addresses of two *object.Object pointers
-		// The result is a native Go boolean
-	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
-	case operator == "==":
-		return nativeBoolToBooleanObj(left == right)
-	case operator == "!=":
-		return nativeBoolToBooleanObj(left != right)
-	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
-	}
-}
-
-func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
-	leftVal := left.(*object.Integer).Value
-	rightVal := right.(*object.Integer).Value
-
-	switch operator {
-	// Group 1: Produce values of other types than booleans
-	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
-	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
-	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
-	case "/":
-		if rightVal == 0 {
-			return newError("division by zero")
-		}
-		return &object.Integer{Value: leftVal / rightVal}
-	case ">>":
-		return &object.Integer{Value: leftVal >> rightVal}
-	case "<<":
-		return &object.Integer{Value: leftVal << rightVal}
-	case "|":
-		return &object.Integer{Value: leftVal | rightVal}
-	case "&":
-		return &object.Integer{Value: leftVal & rightVal}
-	case "^":
-		return &object.Integer{Value: leftVal ^ rightVal}
-	// Group 2: Produce booleans as their results
-	case "<":
-		return nativeBoolToBooleanObj(leftVal < rightVal)
-	case ">":
-		return nativeBoolToBooleanObj(leftVal > rightVal)
-	case "==":
-		return nativeBoolToBooleanObj(leftVal == rightVal)
-	case "!=":
-		return nativeBoolToBooleanObj(leftVal != rightVal)
-	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
-	}
-}
-
-func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
-	// Round up to 6th decimal place
-	leftVal := left.(*object.Float).Value
-	rightVal := right.(*object.Float).Value
-
-	switch operator {
-	case "+":
-		return &object.Float{Value: toFixed(leftVal+rightVal, precision)}
-	case "-":
-		return &object.Float{Value: leftVal - rightVal}
-	case "*":
-		return &object.Float{Value: leftVal * rightVal}
-	case "/":
-		if rightVal == 0 {
-			return newError("division by zero")
-		}
-		return &object.Float{Value: toFixed(leftVal/rightVal, precision)}
-	case "<":
-		return nativeBoolToBooleanObj(leftVal < rightVal)
-	case ">":
-		return nativeBoolToBooleanObj(leftVal > rightVal)
-	case "==":
-		return nativeBoolToBooleanObj(math.Abs(leftVal-rightVal) < epsilon)
-	case "!=":
-		return nativeBoolToBooleanObj(math.Abs(leftVal-rightVal) >= epsilon)
+// Update an element of an array or a hash in place
+func evalIndexAssignment(left, index, val object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			return newError("array index must be INTEGER, got %s", index.Type())
+		}
+		if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return newError("index out of range: %d", i.Value)
+		}
+		left.Elements[i.Value] = val
+	case *object.Hash:
+		key, ok := object.AsHashable(index)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		left.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: val}
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newError("index assignment not supported: %s", left.Type())
 	}
-}
-
-// Round a floating-point number to the nearest integer
-//
-//	Examples:
-//
-// - round(3.7) → 3.7 + 0.5 = 4.2 → 4
-// - round(3.2) → 3.2 + 0.5 = 3.7 → 3
-// - round(-3.7) → -3.7 - 0.5 = -4.2 → -4
-func round(value float64) int {
-	return int(value + math.Copysign(0.5, value))
-}
 
-// Round a floating-point number to a specified number of decimal places (precision)
-func toFixed(value float64, precision int) float64 {
-	output := math.Pow(10, float64(precision))
-	return float64(round(value*output)) / output
+	return val
 }
 
 func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
@@ -454,7 +405,7 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 		return condition
 	}
 
-	if isTruthy(condition) {
+	if object.IsTruthy(condition) {
 		return Eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
 		return Eval(ie.Alternative, env)
@@ -463,6 +414,20 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 	}
 }
 
+func evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	result := Eval(te.Block, env)
+
+	// Errors unwind the Go call stack of Eval by being returned,
+	// so the first try on their way up catches them
+	errObj, ok := result.(*object.Error)
+	if !ok {
+		return result
+	}
+
+	env.Set(te.Param.Value, errObj.Value())
+	return Eval(te.Handler, env)
+}
+
 func evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
 	var body object.Object
 	for {
@@ -471,7 +436,7 @@ func evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.
 			return condition
 		}
 
-		if !isTruthy(condition) {
+		if !object.IsTruthy(condition) {
 			break
 		}
 
@@ -493,7 +458,7 @@ func evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.
 		}
 
 	}
-	return body
+	return unwrapLoopSignal(body)
 }
 
 func evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
@@ -508,7 +473,7 @@ func evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Obje
 		if isError(condition) {
 			return condition
 		}
-		if !isTruthy(condition) {
+		if !object.IsTruthy(condition) {
 			break
 		}
 
@@ -538,20 +503,39 @@ func evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Obje
 			return update
 		}
 	}
-	return body
+	return unwrapLoopSignal(body)
 }
 
-func isTruthy(obj object.Object) bool {
-	switch obj {
-	case NULL:
-		return false
-	case TRUE:
-		return true
-	case FALSE:
-		return false
-	default:
-		return true
+// Stop break and continue from leaking out of the loop they belong to,
+// otherwise the enclosing block would treat them as an early exit.
+// A loop whose body never ran is null too, like on the VM
+func unwrapLoopSignal(obj object.Object) object.Object {
+	if obj == nil || isBreak(obj) || isContinue(obj) {
+		return NULL
 	}
+	return obj
+}
+
+// Evaluate the right operand only if the left one does not decide the result yet
+func evalLogicalExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	if node.Operator == "&&" && !object.IsTruthy(left) {
+		return FALSE
+	}
+	if node.Operator == "||" && object.IsTruthy(left) {
+		return TRUE
+	}
+
+	right := Eval(node.Right, env)
+	if isError(right) {
+		return right
+	}
+
+	return object.NativeBool(object.IsTruthy(right))
 }
 
 func newError(format string, a ...any) *object.Error {
@@ -618,7 +602,10 @@ func evalExpressions(exprs []ast.Expression, env *object.Environment) []object.O
 func applyFunction(fn object.Object, args []object.Object) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
-		extendedEnv := extendedFunctionEnv(fn, args)
+		extendedEnv, err := extendedFunctionEnv(fn, args)
+		if err != nil {
+			return err
+		}
 		// We pass the extended env which EXTENDS (not replaces) the function's enclosed environment
 		// This means the inner function can access values from its outer/enclosing environment a.k.a closure
 		evaluated := Eval(fn.Body, extendedEnv)
@@ -631,19 +618,94 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 		// Check for nil and turn it to NULL
 		// since we don't want to juggle between two instances of *object.NULL
 		return NULL
+	case *object.BoundMethod:
+		return applyFunction(fn.Builtin, append([]object.Object{fn.Receiver}, args...))
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
 }
 
-func extendedFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+// Return the environment of a call, or an error if the arguments don't fit the parameters
+func extendedFunctionEnv(fn *object.Function, args []object.Object) (*object.Environment, object.Object) {
+	optional := 0
+	for _, value := range fn.Defaults {
+		if value != nil {
+			optional++
+		}
+	}
+	if msg := object.ArityError(len(fn.Parameters), optional, fn.Rest != nil, len(args)); msg != "" {
+		return nil, newError("%s", msg)
+	}
+
 	env := object.NewEnclosedEnvironment(fn.Env)
 	// Bind parameters with values inside the enclosed/inner environment
 	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+		var value object.Object
+		if paramIdx < len(args) {
+			value = args[paramIdx]
+		} else {
+			// Defaults are evaluated for every call, and can use the parameters before them
+			value = Eval(fn.Defaults[paramIdx], env)
+			if isError(value) {
+				return nil, value
+			}
+		}
+		env.Set(param.Value, value)
+
+		if paramIdx < len(fn.Patterns) && fn.Patterns[paramIdx] != nil {
+			if err := bindPattern(fn.Patterns[paramIdx], value, env); err != nil {
+				return nil, err
+			}
+		}
 	}
 
-	return env
+	if fn.Rest != nil {
+		rest := []object.Object{}
+		if len(args) > len(fn.Parameters) {
+			rest = append(rest, args[len(fn.Parameters):]...)
+		}
+		env.Set(fn.Rest.Value, &object.Array{Elements: rest})
+	}
+
+	return env, nil
+}
+
+// Bind the parts of a value to the names in a pattern,
+// returning an error if the value doesn't have the shape of the pattern
+func bindPattern(pattern ast.Pattern, val object.Object, env *object.Environment) object.Object {
+	var names []*ast.Identifier
+	var values []object.Object
+	var msg string
+
+	switch pattern := pattern.(type) {
+	case *ast.TuplePattern:
+		names = pattern.Names
+		values, msg = object.TupleElements(val, len(names))
+	case *ast.ArrayPattern:
+		names = pattern.Names
+		if pattern.Rest != nil {
+			names = append(names[:len(names):len(names)], pattern.Rest)
+		}
+		values, msg = object.ArrayElements(val, len(pattern.Names), pattern.Rest != nil)
+	case *ast.HashPattern:
+		names = pattern.Names
+		keys := make([]string, len(names))
+		for i, name := range names {
+			keys[i] = name.Value
+		}
+		values, msg = object.HashValues(val, keys)
+	}
+	if msg != "" {
+		// Point at the pattern rather than the let statement or call around it, like the VM does
+		err := newError("%s", msg)
+		err.Pos = pattern.Pos()
+		return err
+	}
+
+	for i, name := range names {
+		env.Set(name.Value, values[i])
+	}
+	return nil
 }
 
 // This is critical, since we need to stop the evaluation of the LAST-CALLED function's body (Early return)
@@ -669,21 +731,14 @@ func unwrapReturnValue(obj object.Object) object.Object {
 	return obj
 }
 
-func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
-	if operator != "+" {
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
-	}
-
-	leftVal := left.(*object.String).Value
-	rightVal := right.(*object.String).Value
-
-	return &object.String{Value: leftVal + rightVal}
-}
-
 func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTERGER_OBJ:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTERGER_OBJ:
+		return evalStringIndexExpression(left, index)
+	case left.Type() == object.TUPLE_OBJ && index.Type() == object.INTERGER_OBJ:
+		return evalTupleIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
 	default:
@@ -691,6 +746,18 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	}
 }
 
+// Index a string by characters, returning the character as a string
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	idx := index.(*object.Integer).Value
+
+	ch, ok := str.(*object.String).CharAt(idx)
+	if !ok {
+		return NULL
+	}
+
+	return ch
+}
+
 func evalArrayIndexExpression(array, index object.Object) object.Object {
 	arrObj := array.(*object.Array)
 	idx := index.(*object.Integer).Value
@@ -704,6 +771,17 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 	return arrObj.Elements[idx]
 }
 
+func evalTupleIndexExpression(tuple, index object.Object) object.Object {
+	elements := tuple.(*object.Tuple).Elements
+	idx := index.(*object.Integer).Value
+
+	if idx < 0 || idx >= int64(len(elements)) {
+		return NULL
+	}
+
+	return elements[idx]
+}
+
 func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
 	pairs := make(map[object.HashKey]object.HashPair)
 
@@ -713,7 +791,7 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 			return key
 		}
 
-		hashKey, ok := key.(object.Hashable)
+		hashKey, ok := object.AsHashable(key)
 		if !ok {
 			return newError("unusable as hash key: %s", key.Type())
 		}
@@ -732,10 +810,85 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 	return &object.Hash{Pairs: pairs}
 }
 
+func newStructType(node *ast.StructStatement) *object.StructType {
+	st := &object.StructType{Name: node.Name.Value, Fields: []string{}}
+	for _, field := range node.Fields {
+		st.Fields = append(st.Fields, field.Value)
+	}
+	return st
+}
+
+func evalStructLiteral(node *ast.StructLiteral, env *object.Environment) object.Object {
+	typ := Eval(node.Type, env)
+	if isError(typ) {
+		return typ
+	}
+
+	// Evaluate everything before checking the fields, like the VM does
+	given := evalExpressions(node.Values, env)
+	if len(given) == 1 && isError(given[0]) {
+		return given[0]
+	}
+
+	st, ok := typ.(*object.StructType)
+	if !ok {
+		return newError("not a struct type: %s", typ.Type())
+	}
+
+	// Fields left out are null
+	values := make([]object.Object, len(st.Fields))
+	for i := range values {
+		values[i] = NULL
+	}
+
+	for i, field := range node.Fields {
+		idx := st.FieldIndex(field.Value)
+		if idx < 0 {
+			return newError("struct %s has no field %s", st.Name, field.Value)
+		}
+		values[idx] = given[i]
+	}
+
+	return &object.Struct{Def: st, Values: values}
+}
+
+func evalFieldExpression(obj object.Object, field string) object.Object {
+	s, ok := obj.(*object.Struct)
+	if !ok {
+		if method := object.GetMethod(obj, field); method != nil {
+			return method
+		}
+		return newError("%s has no method %s", obj.Type(), field)
+	}
+
+	idx := s.Def.FieldIndex(field)
+	if idx < 0 {
+		return newError("struct %s has no field %s", s.Def.Name, field)
+	}
+
+	return s.Values[idx]
+}
+
+// Update a field of a struct in place
+func evalFieldAssignment(obj object.Object, field string, val object.Object) object.Object {
+	s, ok := obj.(*object.Struct)
+	if !ok {
+		return newError("field access not supported: %s", obj.Type())
+	}
+
+	idx := s.Def.FieldIndex(field)
+	if idx < 0 {
+		return newError("struct %s has no field %s", s.Def.Name, field)
+	}
+
+	s.Values[idx] = val
+	return val
+}
+
 func evalHashIndexExpression(hash, index object.Object) object.Object {
 	hashObj := hash.(*object.Hash)
 
-	key, ok := index.(object.Hashable)
+	key, ok := object.AsHashable(index)
 	if !ok {
 		return newError("unusable as a hash key: %s", index.Type())
 	}
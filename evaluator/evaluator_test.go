@@ -34,6 +34,10 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"5 | 5", 5},
 		{"5 & 5", 5},
 		{"5 ^ 5", 0},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"6 % 3", 0},
+		{"1 + 7 % 4 * 2", 7},
 	}
 
 	for _, tt := range tests {
@@ -136,6 +140,33 @@ func TestEvalFloatExpression(t *testing.T) {
 	}
 }
 
+func TestEvalMixedNumericExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"1 + 2.5", 3.5},
+		{"2.5 + 1", 3.5},
+		{"10 - 0.5", 9.5},
+		{"2 * 1.25", 2.5},
+		{"1 / 3.0", 0.333333},
+		{"1 < 1.5", true},
+		{"2.5 > 3", false},
+		{"1 == 1.0", true},
+		{"1 != 1.0", false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
 func TestEvalBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -147,6 +178,19 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"1 > 2", false},
 		{"1 < 1", false},
 		{"1 > 1", false},
+		{"1 <= 2", true},
+		{"2 <= 1", false},
+		{"1 <= 1", true},
+		{"1 >= 2", false},
+		{"2 >= 1", true},
+		{"1 >= 1", true},
+		{"1 + 1 >= 2 == true", true},
+		{"1.5 <= 1.5", true},
+		{"1.5 >= 2.5", false},
+		{"0.1 + 0.2 <= 0.3", true},
+		{"0.1 + 0.2 >= 0.3", true},
+		{"1 <= 1.0", true},
+		{"2.5 >= 2", true},
 		{"1 == 1", true},
 		{"1 != 1", false},
 		{"1 == 2", false},
@@ -264,6 +308,42 @@ func TestAssignmentExpressions(t *testing.T) {
 		// Assignment with complex expressions
 		{"let x = 5; let y = 3; x = y * 2 + 1; x;", 7},
 		{"let arr = [1, 2, 3]; let i = 0; i = arr[1]; i;", 2},
+
+		// Assignment from inside a function updates the enclosing binding
+		{"let x = 1; let f = funk() { x = 2; }; f(); x;", 2},
+		{"let f = funk() { let c = 0; let g = funk() { c = c + 1; }; g(); g(); c }; f();", 2},
+		{"let f = funk() { let c = 0; let g = funk() { c }; c = 5; g() }; f();", 5},
+		{"let f = funk() { let c = 1; let g = funk() { funk() { c = c * 10; } }; g()(); c }; f();", 10},
+
+		// Assignment to array and hash elements
+		{"let arr = [1, 2, 3]; arr[1] = 5; arr[1];", 5},
+		{"let arr = [1, 2, 3]; arr[0] = arr[1] = 7; arr[0] + arr[1];", 14},
+		{`let h = {"a": 1}; h["a"] = 2; h["a"];`, 2},
+		{`let h = {}; h["b"] = 3; h["b"];`, 3},
+
+		// Compound assignment
+		{"let x = 5; x += 2; x;", 7},
+		{"let x = 5; x -= 2; x;", 3},
+		{"let x = 5; x *= 2; x;", 10},
+		{"let x = 10; x /= 2; x;", 5},
+		{"let x = 1.5; x += 1; x;", 2.5},
+		{`let s = "a"; s += "b"; s;`, "ab"},
+		{"let arr = [1, 2]; arr[1] += 3; arr[1];", 5},
+		// The target of a compound assignment is evaluated once
+		{"let n = 0; let f = funk() { n += 1; 0 }; let a = [10]; a[f()] += 1; n * 100 + a[0];", 111},
+		{"let n = 0; let a = [[5]]; let f = funk() { n += 1; a[0] }; f()[0] *= 2; n * 100 + a[0][0];", 110},
+
+		// Increment and decrement write back to the variable
+		{"let x = 5; x++; x;", 6},
+		{"let x = 5; --x; x;", 4},
+		{"let x = 5; let f = funk() { x++; }; f(); x;", 6},
+		// Increment and decrement write back to elements, evaluating the target once
+		{"let a = [1, 2]; a[1]++; a[1];", 3},
+		{"let a = [1, 2]; a[0]++ + a[0];", 3},
+		{"let a = [5]; ++a[0];", 6},
+		{"let a = [5]; a[0]--; --a[0]; a[0];", 3},
+		{`let h = {"n": 1}; h["n"]++; h["n"];`, 2},
+		{"let n = 0; let f = funk() { n += 1; 0 }; let a = [10]; a[f()]++; n * 100 + a[0];", 111},
 	}
 
 	for _, tt := range tests {
@@ -299,7 +379,35 @@ func TestAssignmentExpressionErrors(t *testing.T) {
 		},
 		{
 			"let x = 5; 5 = 10;",
-			"cannot assign to *ast.IntegerLiteral",
+			"cannot assign to 5",
+		},
+		{
+			"let a = 1; let b = 2; (true ? a : b) = 3;",
+			"cannot assign to (true ? a : b)",
+		},
+		{
+			"let arr = [1]; arr[1] = 2;",
+			"index out of range: 1",
+		},
+		{
+			"let x = 5; x[0] = 1;",
+			"index assignment not supported: INTEGER",
+		},
+		{
+			"5++;",
+			"cannot increment non-identifier: INTEGER",
+		},
+		{
+			"--5;",
+			"cannot increment non-identifier: INTEGER",
+		},
+		{
+			"let x = 1; 2.5--;",
+			"cannot increment non-identifier: FLOAT",
+		},
+		{
+			"let x = 1; ++(x + 1);",
+			"cannot increment non-identifier: (x + 1)",
 		},
 	}
 
@@ -364,6 +472,18 @@ func TestErrorHandling(t *testing.T) {
 			"-true",
 			"unknown operator: -BOOLEAN",
 		},
+		{
+			"1 % 0",
+			"modulo by zero",
+		},
+		{
+			"1.5 % 0",
+			"modulo by zero",
+		},
+		{
+			"1 << -1",
+			"negative shift count: -1",
+		},
 		{
 			"true + false;",
 			"unknown operator: BOOLEAN + BOOLEAN",
@@ -400,6 +520,94 @@ return 1;
 			`{"name": "Monkey"}[funk(x) { x }];`,
 			"unusable as a hash key: FUNCTION",
 		},
+		{
+			"funk(a) { a }()",
+			"wrong number of arguments. got=0, want=1",
+		},
+		{
+			"struct Point { x }; Point { y: 1 }",
+			"struct Point has no field y",
+		},
+		{
+			"struct Point { x }; Point { x: 1 }.y",
+			"struct Point has no field y",
+		},
+		{
+			"struct Point { x }; let p = Point {}; p.y = 1",
+			"struct Point has no field y",
+		},
+		{
+			"let h = {}; h.x",
+			"HASH has no method x",
+		},
+		{
+			`"abc".push(1)`,
+			"STRING has no method push",
+		},
+		{
+			"[1].push()",
+			"wrong number of arguments. got=1, want=2",
+		},
+		{
+			"let n = 1; n.x = 2",
+			"field access not supported: INTEGER",
+		},
+		{
+			"let Point = 5; Point { x: 1 }",
+			"not a struct type: INTEGER",
+		},
+		{
+			"let (a, b) = (1, 2, 3);",
+			"wrong number of values to destructure: want=2, got=3",
+		},
+		{
+			"let (a, b) = [1, 2];",
+			"cannot destructure ARRAY as a tuple",
+		},
+		{
+			"{(1, [2]): 3}",
+			"unusable as hash key: TUPLE",
+		},
+		{
+			"let t = (1, 2); t[0] = 5",
+			"index assignment not supported: TUPLE",
+		},
+		{
+			"let [a, b] = [1];",
+			"wrong number of values to destructure: want=2, got=1",
+		},
+		{
+			"let [a, b, ...rest] = [1];",
+			"wrong number of values to destructure: want at least 2, got=1",
+		},
+		{
+			"let [a] = (1,);",
+			"cannot destructure TUPLE as an array",
+		},
+		{
+			`let {name, age} = {"name": "a"};`,
+			`no key "age" in the hash to destructure`,
+		},
+		{
+			"let {name} = [1];",
+			"cannot destructure ARRAY as a hash",
+		},
+		{
+			"let f = funk([a, b]) { a }; f([1, 2, 3])",
+			"wrong number of values to destructure: want=2, got=3",
+		},
+		{
+			"funk() { 1 }(1)",
+			"wrong number of arguments. got=1, want=0",
+		},
+		{
+			"funk(a, b = 2) { a }(1, 2, 3)",
+			"wrong number of arguments. got=3, want=1 to 2",
+		},
+		{
+			"funk(a, ...rest) { a }()",
+			"wrong number of arguments. got=0, want at least 1",
+		},
 		// TODO: Fail test from here
 		// {
 		// 	"let x = 5; x++ ++",
@@ -465,6 +673,16 @@ func TestFunctionApplication(t *testing.T) {
 		// Two forms of *ast.CallExpression
 		{"let add = funk(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20}, // Function as an identifier evaluating to a function obj
 		{"funk(x) { x; }(5)", 5}, // Function is a function literal aka Anonymous function
+		// Defaults are only computed for the parameters left out, and can use the ones before them
+		{"let add = funk(a, b = 10) { a + b }; add(1);", 11},
+		{"let add = funk(a, b = 10) { a + b }; add(1, 2);", 3},
+		{"let f = funk(a, b = a * 2) { a + b }; f(3);", 9},
+		{"let n = 0; let f = funk(a = n) { a }; n = 5; f();", 5},
+		// Arguments after the parameters are collected into the rest parameter
+		{"let count = funk(...rest) { len(rest) }; count();", 0},
+		{"let count = funk(a, ...rest) { len(rest) }; count(1, 2, 3);", 2},
+		{"let f = funk(a, b = 2, ...rest) { a + b + len(rest) }; f(1);", 3},
+		{"let last = funk(a, ...rest) { rest[len(rest) - 1] }; last(1, 2, 3);", 3},
 	}
 	for _, tt := range tests {
 		testIntegerObject(t, testEval(tt.input), tt.expected)
@@ -505,6 +723,69 @@ func TestStringConcatenation(t *testing.T) {
 	}
 }
 
+func TestStringComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "a"`, true},
+		{`"mon" + "key" == "monkey"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "b"`, true},
+		{`"a" != "a"`, false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestUnicodeStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`len("héllo")`, 5},
+		{`len("世界")`, 2},
+		{`len("👋🏽")`, 2},
+		{`"héllo"[1]`, "é"},
+		{`"世界"[1]`, "界"},
+		{`let s = "abc"; s[len(s) - 1]`, "c"},
+		{`"héllo"[5]`, nil},
+		{`"héllo"[-1]`, nil},
+		{`""[0]`, nil},
+		{`let café = "☕"; café`, "☕"},
+		{`"héllo, " + "世界"`, "héllo, 世界"},
+		// Escape sequences are decoded by the lexer
+		{`"a\tb\n"`, "a\tb\n"},
+		{`"say \"hi\""`, `say "hi"`},
+		{`len("\u{1F44B}\n")`, 2},
+		{`"\\"[0]`, `\`},
+		{"`raw\n\\n` + \"!\"", "raw\n\\n!"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. want=%q, got=%q", expected, str.Value)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
 func TestBuiltinFunction(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -514,13 +795,15 @@ func TestBuiltinFunction(t *testing.T) {
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
 		{`let arr = [1, 2 ,3]; len(arr)`, 3},
+		{`len({"a": 1, "b": 2})`, 2},
 		{`let arr = [1, 2 ,3]; first(arr)`, 1},
 		{`let arr = [1, 2 ,3]; last(arr)`, 3},
 		{`let arr = [1, 2 ,3]; rest(arr)`, [2]int{2, 3}},
 		{`let arr = [1, 2 ,3]; push(arr, 4)`, [4]int{1, 2, 3, 4}},
 		{`power(2, 3)`, 8},
-		{`len(1)`, "argument to `len` not supported. got: INTEGER"},
-		{`len("one", "two")`, "wrong number of arguments. got: 2, want: 1"},
+		{`let h = {"b": 2, "a": 1}; keys(h)`, []string{"a", "b"}},
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -536,11 +819,69 @@ func TestBuiltinFunction(t *testing.T) {
 			if errObj.Message != expected {
 				t.Errorf("wrong error message. expected: %q, got: %q", expected, errObj.Message)
 			}
+		case []string:
+			arr, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("object is not Array. got: %T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if len(arr.Elements) != len(expected) {
+				t.Errorf("wrong number of elements. want=%d, got=%d", len(expected), len(arr.Elements))
+				continue
+			}
+			for i, elem := range arr.Elements {
+				if elem.Inspect() != expected[i] {
+					t.Errorf("wrong element %d. want=%q, got=%q", i, expected[i], elem.Inspect())
+				}
+			}
 		}
 
 	}
 }
 
+func TestLogicalExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"true || false", true},
+		// Same truthiness as if: only false and null are falsy
+		{"1 && 0", true},
+		{`"" || false`, true},
+		{"if (false) { 1 } || false", false},
+		{"1 > 2 || 3 > 2 && 4 > 3", true},
+		// The right operand only runs if it can change the result
+		{"let x = 0; false && (x = 1); x == 0", true},
+		{"let x = 0; true && (x = 1); x == 1", true},
+		{"let x = 0; true || (x = 1); x == 0", true},
+		{"let x = 0; false || (x = 1); x == 1", true},
+		// The whole logical expression is the condition of a ternary
+		{"false && true ? false : true", true},
+		{"true || false ? false : true", false},
+		{"false && (1 + true)", false},
+		{"true || [][0][0]", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+
+	evaluated := testEval("true && (1 + true)")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got: %T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("wrong error message. got: %q", errObj.Message)
+	}
+}
+
 func TestTernaryExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -553,8 +894,12 @@ func TestTernaryExpressions(t *testing.T) {
 		// Nested ternary operations
 		{"true ? (false ? 10 : 20) : 30", 20},
 		{"false ? 10 : (true ? 20 : 30)", 20},
+		{"true ? false ? 1 : 2 : 3", 2},
+		{"false ? 1 : false ? 2 : 3", 3},
 
 		// With expressions as condition
+		{"1 == 1 ? 10 : 20", 10},
+		{"1 != 1 ? 10 : 20", 20},
 		{"5 > 3 ? 10 : 20", 10},
 		{"5 < 3 ? 10 : 20", 20},
 
@@ -786,6 +1131,159 @@ func TestHashIndexExpression(t *testing.T) {
 	}
 }
 
+func TestStructs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"struct Point { x, y }; Point { x: 1, y: 2 }.y", 2},
+		{"struct Point { x, y }; Point { y: 2 }.x", nil},
+		{"struct Point { x, y }; let p = Point { x: 1, y: 2 }; p.x = 5; p.x + p.y", 7},
+		{"struct Point { x, y }; let p = Point { x: 1 }; p.x += 2; p.x", 3},
+		{"struct Point { x }; let p = Point { x: 1 }; p.x++; p.x", 2},
+		{"struct Point { x }; let p = Point { x: 1 }; p.x-- * 10 + p.x", 10},
+		{"struct Point { x }; let p = Point { x: 1 }; ++p.x", 2},
+		{"struct Point { x, y }; let p = Point { x: 1 }; let n = 0; let f = funk() { n += 1; p }; f().x += 2; n * 10 + p.x", 13},
+		{"struct Counter { n }; let c = Counter { n: 0 }; let inc = funk(c) { c.n = c.n + 1 }; inc(c); inc(c); c.n", 2},
+		{"struct Box { inner }; struct Point { x }; let b = Box { inner: Point { x: 4 } }; b.inner.x", 4},
+		// Inspect shows the fields in the order they are declared in
+		{`struct Point { x, label }; Point { label: "a", x: 1 }`, `Point { x: 1, label: "a" }`},
+		{"struct Point { x, y }; Point", "struct Point { x, y }"},
+		{"let f = funk() { struct Local { v }; Local { v: 3 } }; f().v", 3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong Inspect. want=%q, got=%q", expected, evaluated.Inspect())
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestTuples(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"(1, 2, 3)[1]", 2},
+		{"(1, 2)[2]", nil},
+		{"len((1, 2, 3))", 3},
+		{"(4, 5).len()", 2},
+		{`(1, "a", true)`, "(1, a, true)"},
+		{"(1,)", "(1,)"},
+		{"()", "()"},
+		{`let h = {(1, "a"): 5, (1, "b"): 6}; h[(1, "a")] + h[(1, "b")]`, 11},
+		{"let h = {(1, (2, 3)): 4}; h[(1, (2, 3))]", 4},
+		{"let h = {(1, 2): 4}; h[(2, 1)]", nil},
+		{"let divmod = funk(a, b) { return a / b, a % b; }; let (q, r) = divmod(7, 2); q * 10 + r", 31},
+		{"let f = funk() { let (a, b) = (1, 2); let (b, a) = (a, b); a - b }; f()", 1},
+		{"let (x,) = (9,); x", 9},
+		// Tuples are compared element by element
+		{"(1, 2) == (1, 2)", true},
+		{"(1, 2) != (1, 2)", false},
+		{"(1, 2) == (2, 1)", false},
+		{"(1, 2) == (1, 2, 3)", false},
+		{`(1, "a", (true, 2.5)) == (1, "a", (true, 2.5))`, true},
+		{"(1, 2.0) == (1.0, 2)", true},
+		{`(1, "a") != ("a", 1)`, true},
+		{"let t = (1, 2); let (a, b) = t; (b, a) == (2, 1)", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong Inspect. want=%q, got=%q", expected, evaluated.Inspect())
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"let [a, b] = [1, 2]; a * 10 + b", 12},
+		{"let [a, b, ...rest] = [1, 2, 3, 4]; rest", "[3, 4]"},
+		{"let [a, ...rest] = [1]; rest", "[]"},
+		{`let {name, age} = {"age": 28, "name": "Hong Anh", "club": "x"}; name`, "Hong Anh"},
+		{`let {age} = {"age": 28}; age`, 28},
+		{`let {n} = {"n": [].first()}; n`, nil},
+		{"let f = funk() { let [x, y] = [3, 4]; x * y }; f()", 12},
+		{"let f = funk([a, b]) { a - b }; f([5, 2])", 3},
+		{`let f = funk(n, {x, y}) { n + x + y }; f(1, {"x": 2, "y": 3})`, 6},
+		{"let f = funk([a, ...rest], b = len(rest)) { a + b }; f([1, 2, 3])", 3},
+		{"let f = funk((a, b), c) { a + b + c }; f((1, 2), 3)", 6},
+		{"let f = funk(t) { let (a, b) = t; funk([c]) { a + b + c } }; f((1, 2))([3])", 6},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong Inspect. want=%q, got=%q", expected, evaluated.Inspect())
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestMethodCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"[1, 2, 3].len()", 3},
+		{`"héllo".len()`, 5},
+		{`{"a": 1}.len()`, 1},
+		{"let arr = [1, 2]; arr.push(3).last()", 3},
+		{"let arr = [1, 2]; arr.push(3); arr.len()", 2},
+		{"[1, 2, 3].rest().first()", 2},
+		{"2.power(10)", 1024},
+		{"let n = 3; n.power(2) + 1", 10},
+		{`{"b": 2, "a": 1}.keys()`, "[a, b]"},
+		{"let last = [1, 2, 3].last; last()", 3},
+		{"[].first()", nil},
+		{"let f = funk(a) { return a.push(9).len(); }; f([1])", 2},
+		// A function in a field of a struct is called without a receiver
+		{"struct S { f }; let s = S { f: funk(x) { x * 2 } }; s.f(4)", 8},
+		{"[1].push", "builtin method push"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong Inspect. want=%q, got=%q", expected, evaluated.Inspect())
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
 /*
 HELPER FUNCTIONS
 */
@@ -817,6 +1315,11 @@ func TestWhileStatements(t *testing.T) {
 		// {"let i = 0; let count = 0; while (i < 10) { i = i + 1; if (i == 1 || i == 3 || i == 5 || i == 7 || i == 9) { continue; } count = count + 1; } count;", 5},
 		// While loop with break in nested if
 		{"let i = 0; while (true) { i = i + 1; if (i > 5) { if (i == 7) { break; } } } i;", 7},
+		// Functions and blocks ending with a loop that never runs or a let are null
+		{"let f = funk() { while (false) {} }; f();", nil},
+		{"let f = funk() { for (let i = 0; i < 0; i = i + 1) {} }; f();", nil},
+		{"let f = funk() { let x = 1; }; f();", nil},
+		{"if (true) { let x = 1; }", nil},
 	}
 
 	for i, tt := range tests {
@@ -834,6 +1337,10 @@ func TestWhileStatements(t *testing.T) {
 			if !testBooleanObject(t, evaluated, expected) {
 				t.Errorf("Test case %d failed: input=%q, expected=%t", i, tt.input, expected)
 			}
+		case nil:
+			if !testNullObject(t, evaluated) {
+				t.Errorf("Test case %d failed: input=%q, expected=null", i, tt.input)
+			}
 		}
 	}
 }
@@ -922,7 +1429,7 @@ func TestForStatementsWithBreakContinue(t *testing.T) {
 				}
 			}
 			result`,
-			12, // 1+3+5+3 (breaks when result becomes 12)
+			16, // 1+3+5+7 (breaks once result goes past 10)
 		},
 	}
 
@@ -954,7 +1461,7 @@ func TestForStatementsWithFloats(t *testing.T) {
 					result = result * i;
 				}
 				result`,
-			1.875, // 1.0 * 0.5 * 1.0 * 1.5 * 2.0
+			1.5, // 1.0 * 0.5 * 1.0 * 1.5 * 2.0
 		},
 	}
 
@@ -1003,6 +1510,41 @@ func TestNestedForStatements(t *testing.T) {
 	}
 }
 
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedLine   int
+		expectedColumn int
+	}{
+		{"5 + true;", 1, 3},
+		{"let x = 1;\n  foobar", 2, 3},
+		// Errors inside a function point at the body, not at the call
+		{"let f = funk(a) {\n  a / 0.0\n};\nf(1);", 2, 5},
+		{`len(1)`, 1, 4},
+		// The same columns as the compiler reports
+		{"5++;", 1, 2},
+		{"--5;", 1, 1},
+		{"let x = 1; 2.5--;", 1, 15},
+		{"let x = 1; ++(x + 1);", 1, 12},
+		{"let a = 1; let b = 2; (true ? a : b) = 3;", 1, 29},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got: %T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Pos.Line != tt.expectedLine || errObj.Pos.Column != tt.expectedColumn {
+			t.Errorf("wrong error position for %q. expected: %d:%d, got: %s",
+				tt.input, tt.expectedLine, tt.expectedColumn, errObj.Pos)
+		}
+	}
+}
+
 func testEval(input string) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
@@ -1065,3 +1607,129 @@ func testNullObject(t *testing.T, obj object.Object) bool {
 	}
 	return true
 }
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`try { 1 } catch (e) { 2 }`, 1},
+		{`try { 1 / 0 } catch (e) { 2 }`, 2},
+		{`try { 1 / 0 } catch (e) { e["message"] }`, "division by zero"},
+		{`try { error("boom") } catch (e) { e["message"] }`, "boom"},
+		{`try { len(1) } catch (e) { e["message"] }`, "argument to `len` not supported, got INTEGER"},
+		{`try { [1, 2][0] + "a" } catch (e) { e["message"] }`, "type mismatch: INTEGER + STRING"},
+		{`try { 1 / 0 } catch (e) { }`, nil},
+		{`let x = try { error("a") } catch (e) { 5 }; x * 2`, 10},
+		{`1 + try { 2 } catch (e) { 3 } + 4`, 7},
+		{`
+		let f = funk() { error("deep") };
+		let g = funk() { f() };
+		try { g() } catch (e) { e["message"] }
+		`, "deep"},
+		{`
+		try {
+			try { error("inner") } catch (e) { error(e["message"] + " again") }
+		} catch (e) {
+			e["message"]
+		}
+		`, "inner again"},
+		{`
+		let f = funk(x) { try { if (x > 0) { return x; } error("neg") } catch (e) { 0 } };
+		f(1) + f(-1)
+		`, 1},
+		{`
+		let sum = 0;
+		for (let i = 0; i < 5; i++) {
+			try {
+				if (i == 1) { continue; }
+				if (i == 3) { break; }
+				sum = sum + i;
+			} catch (e) { }
+		}
+		sum
+		`, 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got: %T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. got: %q, want: %q", str.Value, expected)
+			}
+		case nil:
+			if evaluated != nil {
+				testNullObject(t, evaluated)
+			}
+		}
+	}
+
+	evaluated := testEval(`try { error("a") } catch (e) { error("b") }`)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got: %T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "b" {
+		t.Errorf("wrong error message. got: %q", errObj.Message)
+	}
+}
+
+// Programs for the benchmarks, the ones the vm package runs with a smaller fibonacci
+var benchmarks = []struct {
+	name  string
+	input string
+}{
+	{"fibonacci", `
+	let fibonacci = funk(x) {
+		if (x == 0) {
+			0
+		} else {
+			if (x == 1) {
+				return 1;
+			} else {
+				fibonacci(x - 1) + fibonacci(x - 2);
+			}
+		}
+	}
+	fibonacci(20);
+	`},
+	{"loop", `
+	let sum = 0;
+	for (let i = 0; i < 100000; i++) {
+		sum = sum + i % 7;
+	}
+	sum
+	`},
+	{"strings", `
+	let text = "the quick brown fox jumps over the lazy dog";
+	let copy = "";
+	for (let i = 0; i < len(text); i++) {
+		copy = copy + text[i];
+	}
+	copy
+	`},
+}
+
+func BenchmarkPrograms(b *testing.B) {
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			program := parser.New(lexer.New(bm.input)).ParseProgram()
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				result := Eval(program, object.NewEnvironment())
+				if isError(result) {
+					b.Fatalf("eval error: %s", result.Inspect())
+				}
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package evaluator
 
 import (
+	"fmt"
 	"s8/ast"
 	"s8/object"
 	"slices"
@@ -28,7 +29,7 @@ func DefineMacros(program *ast.Program, env *object.Environment) {
 
 func isMacroDefinition(node ast.Statement) bool {
 	letStmt, ok := node.(*ast.LetStatement)
-	if !ok {
+	if !ok || letStmt.Name == nil {
 		return false
 	}
 
@@ -82,6 +83,25 @@ func ExpandMacros(program ast.Node, env *object.Environment) ast.Node {
 	})
 }
 
+// Run the whole macro pass over a program before it is handed to the compiler:
+// collect the macro definitions into env, then expand the macro calls.
+// The caller owns env, so macros defined in one program (e.g., a REPL line)
+// are still available when expanding the next one
+func ExpandProgram(program *ast.Program, env *object.Environment) (expanded *ast.Program, err error) {
+	// ExpandMacros panics on macros that do not return quoted code,
+	// which we do not want to take the whole host process down
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("macro expansion failed: %v", r)
+		}
+	}()
+
+	DefineMacros(program, env)
+	expanded, _ = ExpandMacros(program, env).(*ast.Program)
+
+	return expanded, nil
+}
+
 func isMacroCall(expr *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
 	ident, ok := expr.Function.(*ast.Identifier)
 	if !ok {
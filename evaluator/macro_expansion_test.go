@@ -103,6 +103,11 @@ func TestExpandMacros(t *testing.T) {
 `,
 			`if (!(10 > 5)) { puts("not greater") } else { puts("greater") }`,
 		},
+		// Every call expands from the macro body as it was defined
+		{
+			`let double = macro(x) { quote(unquote(x) * 2); }; double(a); double(b);`,
+			`(a * 2); (b * 2)`,
+		},
 	}
 	for _, tt := range tests {
 		expected := testParseProgram(tt.expected)
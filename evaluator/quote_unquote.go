@@ -9,7 +9,9 @@ import (
 
 // Return an *object.Quote with an un-evaluated ast.Node
 func quote(node ast.Node, env *object.Environment) object.Object {
-	node = evalUnquoteCall(node, env)
+	// Unquote on a copy, since Modify changes the tree in place
+	// and the quoted node may belong to a macro body that is expanded again later
+	node = evalUnquoteCall(ast.Copy(node), env)
 	return &object.Quote{Node: node}
 }
 
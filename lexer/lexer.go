@@ -1,34 +1,58 @@
 package lexer
 
 import (
+	"fmt"
 	"s8/token"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Include pointers to peek further into the input
 type Lexer struct {
 	input        string
-	position     int  // current char
-	readPosition int  // after current char
+	position     int  // byte offset of the current char
+	readPosition int  // byte offset after the current char
 	ch           rune // current char under examination
+
+	filename string
+	line     int // line of the current char
+	column   int // column of the current char
+
+	comments []token.Token // the comments skipped so far
+	errors   []string
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewWithFilename(input, "")
+}
+
+// Same as New, but the positions of the tokens also carry the file name
+func NewWithFilename(input string, filename string) *Lexer {
+	l := &Lexer{input: input, filename: filename, line: 1}
 	l.readChar()
 	return l
 }
 
 // Get the next char and advance our position
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line += 1
+		l.column = 1
+	} else {
+		l.column += 1
+	}
+
+	// Chars can take up to 4 bytes in UTF-8
+	size := 1
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
-		l.ch = rune(l.input[l.readPosition])
+		l.ch, size = utf8.DecodeRuneInString(l.input[l.readPosition:])
 	}
 
 	l.position = l.readPosition
-	l.readPosition += 1
+	l.readPosition += size
 }
 
 // Handle cases like != and ==
@@ -41,18 +65,95 @@ func (l *Lexer) makeTwoCharToken(tokenType token.TokenType) token.Token {
 }
 
 // Get the next char but NOT advance our position
-func (l *Lexer) peekChar() byte {
+func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
-	} else {
-		return l.input[l.readPosition]
 	}
+
+	ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	return ch
 }
 
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
+	for {
+		l.skipWhiteSpace()
 
-	l.skipWhiteSpace()
+		// Tokens are positioned at their first character
+		pos := l.currentPosition()
+
+		if l.ch == '/' && (l.peekChar() == '/' || l.peekChar() == '*') {
+			comment, ok := l.readComment()
+			comment.Pos = pos
+			if !ok {
+				l.errorAt(pos, "unterminated block comment")
+				return token.Token{Type: token.ILLEGAL, Literal: comment.Literal, Pos: pos}
+			}
+
+			l.comments = append(l.comments, comment)
+			continue
+		}
+
+		numErrors := len(l.errors)
+		tok := l.nextToken()
+		tok.Pos = pos
+		// Unless the lexer already said what is wrong, e.g., with a broken string literal
+		if tok.Type == token.ILLEGAL && len(l.errors) == numErrors {
+			l.errorAt(pos, "illegal character %q", tok.Literal)
+		}
+
+		return tok
+	}
+}
+
+// Return the comments the lexer has skipped so far, in source order
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
+}
+
+// Return the errors found while scanning, e.g., an unterminated comment
+func (l *Lexer) Errors() []string {
+	return l.errors
+}
+
+func (l *Lexer) errorAt(pos token.Position, format string, a ...any) {
+	msg := fmt.Sprintf("%s: %s", pos, fmt.Sprintf(format, a...))
+	l.errors = append(l.errors, msg)
+}
+
+// Read a // line comment up to the end of the line or a /* */ block comment.
+// The literal keeps the delimiters, and is false if the block comment is never closed
+func (l *Lexer) readComment() (token.Token, bool) {
+	position := l.position
+	l.readChar() // the first '/'
+
+	if l.ch == '/' {
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+		return token.Token{Type: token.COMMENT, Literal: l.input[position:l.position]}, true
+	}
+
+	l.readChar() // the '*'
+	for {
+		if l.ch == 0 {
+			return token.Token{Type: token.COMMENT, Literal: l.input[position:l.position]}, false
+		}
+		if l.ch == '*' && l.peekChar() == '/' {
+			l.readChar()
+			l.readChar()
+			return token.Token{Type: token.COMMENT, Literal: l.input[position:l.position]}, true
+		}
+		l.readChar()
+	}
+}
+
+func (l *Lexer) currentPosition() token.Position {
+	return token.Position{Filename: l.filename, Line: l.line, Column: l.column}
+}
+
+func (l *Lexer) nextToken() token.Token {
+	var tok token.Token
+	var ok bool
 
 	switch l.ch {
 	case '=':
@@ -75,6 +176,8 @@ func (l *Lexer) NextToken() token.Token {
 	case '+':
 		if l.peekChar() == '+' {
 			tok = l.makeTwoCharToken(token.INCREMENT)
+		} else if l.peekChar() == '=' {
+			tok = l.makeTwoCharToken(token.PLUS_ASSIGN)
 		} else {
 			tok = newToken(token.PLUS, l.ch)
 		}
@@ -85,6 +188,8 @@ func (l *Lexer) NextToken() token.Token {
 	case '-':
 		if l.peekChar() == '-' {
 			tok = l.makeTwoCharToken(token.DECREMENT)
+		} else if l.peekChar() == '=' {
+			tok = l.makeTwoCharToken(token.MINUS_ASSIGN)
 		} else {
 			tok = newToken(token.MINUS, l.ch)
 		}
@@ -95,21 +200,35 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.makeTwoCharToken(token.ASTERISK_ASSIGN)
+		} else {
+			tok = newToken(token.ASTERISK, l.ch)
+		}
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.makeTwoCharToken(token.SLASH_ASSIGN)
+		} else {
+			tok = newToken(token.SLASH, l.ch)
+		}
 	case '<':
 		if l.peekChar() == '<' {
 			tok = l.makeTwoCharToken(token.LSHIFT)
+		} else if l.peekChar() == '=' {
+			tok = l.makeTwoCharToken(token.LTE)
 		} else {
 			tok = newToken(token.LT, l.ch)
 		}
 	case '>':
 		if l.peekChar() == '>' {
 			tok = l.makeTwoCharToken(token.RSHIFT)
+		} else if l.peekChar() == '=' {
+			tok = l.makeTwoCharToken(token.GTE)
 		} else {
 			tok = newToken(token.GT, l.ch)
 		}
+	case '%':
+		tok = newToken(token.MODULO, l.ch)
 	case '[':
 		tok = newToken(token.LBRACKET, l.ch)
 	case ']':
@@ -117,9 +236,17 @@ func (l *Lexer) NextToken() token.Token {
 	case '~':
 		tok = newToken(token.TILDE, l.ch)
 	case '|':
-		tok = newToken(token.PIPE, l.ch)
+		if l.peekChar() == '|' {
+			tok = l.makeTwoCharToken(token.OR)
+		} else {
+			tok = newToken(token.PIPE, l.ch)
+		}
 	case '&':
-		tok = newToken(token.AMPERSAND, l.ch)
+		if l.peekChar() == '&' {
+			tok = l.makeTwoCharToken(token.AND)
+		} else {
+			tok = newToken(token.AMPERSAND, l.ch)
+		}
 	case '?':
 		tok = newToken(token.QUESTION, l.ch)
 	case '^':
@@ -129,13 +256,27 @@ func (l *Lexer) NextToken() token.Token {
 		tok.Type = token.EOF
 	case '"':
 		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		if tok.Literal, ok = l.readString(); !ok {
+			tok.Type = token.ILLEGAL
+		}
+	case '`':
+		tok.Type = token.STRING
+		if tok.Literal, ok = l.readRawString(); !ok {
+			tok.Type = token.ILLEGAL
+		}
 	default:
 		if isLetter(l.ch) {
 			// Pretty interesting: This is in reverse compared to when we deal with digits
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
 			return tok
+		} else if strings.HasPrefix(l.input[l.position:], "...") {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else if l.ch == '.' && !('0' <= l.peekChar() && l.peekChar() <= '9') {
+			// A dot not starting a number like .5 accesses a field
+			tok = newToken(token.DOT, l.ch)
 		} else if isDigit(l.ch) {
 			literal := l.readNumber()
 			if strings.Contains(literal, ".") {
@@ -161,9 +302,11 @@ func newToken(tokenType token.TokenType, ch rune) token.Token {
 }
 
 // Changing this function will have a large impact on how our interpreter will parse
-// Like the check for '_' means we can use snake case e.g., foo_bar as identifier
+// Like the check for '_' means we can use snake case e.g., foo_bar as identifier.
+// Any Unicode letter works too, so names like café or 変数 are fine
 func isLetter(ch rune) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' || ch == '!' || ch == '?'
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' || ch == '!' || ch == '?' ||
+		ch >= utf8.RuneSelf && unicode.IsLetter(ch)
 }
 
 // Return the literal value of the identifer
@@ -196,6 +339,10 @@ func (l *Lexer) readNumber() string {
 			if seenDot {
 				break // Do NOT allow multiple decimal points
 			}
+			// A dot without digits after it calls a method, e.g. 2.power(3)
+			if next := l.peekChar(); next < '0' || next > '9' {
+				break
+			}
 		}
 		l.readChar()
 	}
@@ -206,16 +353,110 @@ func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9' || ch == '.'
 }
 
-func (l *Lexer) readString() string {
-	// Move to the chars inside the ""
-	pos := l.position + 1
+// Read a "" string literal and return its value with the escape sequences decoded.
+// Return false if the literal is broken, in which case the error is already recorded
+func (l *Lexer) readString() (string, bool) {
+	start := l.currentPosition()
+	var out strings.Builder
+	ok := true
+
 	for {
+		// Move to the chars inside the ""
 		l.readChar()
-		// Reaching the end of the string
-		if l.ch == '"' || l.ch == 0 {
-			break
+
+		switch l.ch {
+		case '"':
+			return out.String(), ok
+		case 0:
+			l.errorAt(start, "unterminated string literal")
+			return out.String(), false
+		case '\\':
+			escapePos := l.currentPosition()
+			l.readChar()
+			ch, valid := l.readEscape()
+			if !valid {
+				l.errorAt(escapePos, "invalid escape sequence in string literal")
+				// Keep going, so the rest of the literal is consumed
+				ok = false
+				continue
+			}
+			out.WriteRune(ch)
+		default:
+			out.WriteRune(l.ch)
 		}
 	}
+}
 
-	return l.input[pos:l.position]
+// Decode the escape sequence starting at the char after the backslash
+func (l *Lexer) readEscape() (rune, bool) {
+	switch l.ch {
+	case 'n':
+		return '\n', true
+	case 't':
+		return '\t', true
+	case '\\':
+		return '\\', true
+	case '"':
+		return '"', true
+	case 'u':
+		// \u{...} with 1 to 6 hex digits
+		if l.peekChar() != '{' {
+			return 0, false
+		}
+		l.readChar()
+
+		var value rune
+		digits := 0
+		for l.peekChar() != '}' {
+			l.readChar()
+			d, ok := hexValue(l.ch)
+			if !ok {
+				return 0, false
+			}
+			value = value*16 + d
+			digits++
+			if digits > 6 {
+				return 0, false
+			}
+		}
+		l.readChar() // the '}'
+
+		if digits == 0 || !utf8.ValidRune(value) {
+			return 0, false
+		}
+		return value, true
+	default:
+		return 0, false
+	}
+}
+
+func hexValue(ch rune) (rune, bool) {
+	switch {
+	case '0' <= ch && ch <= '9':
+		return ch - '0', true
+	case 'a' <= ch && ch <= 'f':
+		return ch - 'a' + 10, true
+	case 'A' <= ch && ch <= 'F':
+		return ch - 'A' + 10, true
+	default:
+		return 0, false
+	}
+}
+
+// Read a raw string literal between backticks as is: no escape sequences, and it may span multiple lines
+func (l *Lexer) readRawString() (string, bool) {
+	start := l.currentPosition()
+	pos := l.position + 1
+
+	for {
+		l.readChar()
+
+		switch l.ch {
+		case '`':
+			return l.input[pos:l.position], true
+		case 0:
+			l.errorAt(start, "unterminated raw string literal")
+			return l.input[pos:l.position], false
+		}
+	}
 }
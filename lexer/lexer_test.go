@@ -15,7 +15,7 @@ let add = funk(x, y) {
 };
 
 let result = add(five, ten);
-!-/*?~|5;
+!-/ *?~|5;
 5 < 10 > 5;
 3 >> 2; 5 << 6; 5 & 6; 5 ^ 6;
 
@@ -54,6 +54,10 @@ for (let i = 0; i < 10; ) {
 for (;;) {
 	x + i;
 };
+x += 1; x -= 1; x *= 2; x /= 2;
+a && b || c & d | e;
+a <= b >= c % d;
+struct Point { x }; p.x; .5; 2.power;
 `
 
 	tests := []struct {
@@ -334,6 +338,60 @@ for (;;) {
 		{token.RBRACE, "}"},
 		{token.SEMICOLON, ";"},
 
+		{token.IDENT, "x"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+
+		{token.IDENT, "a"},
+		{token.AND, "&&"},
+		{token.IDENT, "b"},
+		{token.OR, "||"},
+		{token.IDENT, "c"},
+		{token.AMPERSAND, "&"},
+		{token.IDENT, "d"},
+		{token.PIPE, "|"},
+		{token.IDENT, "e"},
+		{token.SEMICOLON, ";"},
+
+		{token.IDENT, "a"},
+		{token.LTE, "<="},
+		{token.IDENT, "b"},
+		{token.GTE, ">="},
+		{token.IDENT, "c"},
+		{token.MODULO, "%"},
+		{token.IDENT, "d"},
+		{token.SEMICOLON, ";"},
+
+		{token.STRUCT, "struct"},
+		{token.IDENT, "Point"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "x"},
+		{token.RBRACE, "}"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "p"},
+		{token.DOT, "."},
+		{token.IDENT, "x"},
+		{token.SEMICOLON, ";"},
+		{token.FLOAT, ".5"},
+		{token.SEMICOLON, ";"},
+		{token.INT, "2"},
+		{token.DOT, "."},
+		{token.IDENT, "power"},
+		{token.SEMICOLON, ";"},
+
 		{token.EOF, ""},
 	}
 
@@ -349,3 +407,263 @@ for (;;) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  x == 10;
+
+"two
+lines" + y`
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.LET, 1, 1},
+		{token.IDENT, 1, 5},
+		{token.ASSIGN, 1, 7},
+		{token.INT, 1, 9},
+		{token.SEMICOLON, 1, 10},
+		{token.IDENT, 2, 3},
+		{token.EQ, 2, 5},
+		{token.INT, 2, 8},
+		{token.SEMICOLON, 2, 10},
+		{token.STRING, 4, 1},
+		// The string spans two lines, so the columns after it restart
+		{token.PLUS, 5, 8},
+		{token.IDENT, 5, 10},
+		{token.EOF, 5, 11},
+	}
+
+	l := NewWithFilename(input, "test.s8")
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Pos.Line != tt.expectedLine || tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Pos.Line, tok.Pos.Column)
+		}
+
+		if tok.Pos.Filename != "test.s8" {
+			t.Fatalf("tests[%d] - filename wrong. expected=%q, got=%q", i, "test.s8", tok.Pos.Filename)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading comment
+let x = 5; // trailing comment
+/* block
+   comment */ x / 2;
+let y = /**/ 1;
+//`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.LET, "let"},
+		{token.IDENT, "y"},
+		{token.ASSIGN, "="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong; expected: %q, got: %q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong; expected: %q, got: %q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+
+	// The comments are kept as trivia, with their positions
+	expectedComments := []struct {
+		literal string
+		line    int
+		column  int
+	}{
+		{"// leading comment", 1, 1},
+		{"// trailing comment", 2, 12},
+		{"/* block\n   comment */", 3, 1},
+		{"/**/", 5, 9},
+		{"//", 6, 1},
+	}
+
+	comments := l.Comments()
+	if len(comments) != len(expectedComments) {
+		t.Fatalf("wrong number of comments. expected: %d, got: %d (%+v)", len(expectedComments), len(comments), comments)
+	}
+
+	for i, expected := range expectedComments {
+		comment := comments[i]
+
+		if comment.Type != token.COMMENT {
+			t.Errorf("comments[%d] - tokentype wrong; expected: %q, got: %q", i, token.COMMENT, comment.Type)
+		}
+
+		if comment.Literal != expected.literal {
+			t.Errorf("comments[%d] - literal wrong; expected: %q, got: %q", i, expected.literal, comment.Literal)
+		}
+
+		if comment.Pos.Line != expected.line || comment.Pos.Column != expected.column {
+			t.Errorf("comments[%d] - position wrong; expected: %d:%d, got: %d:%d",
+				i, expected.line, expected.column, comment.Pos.Line, comment.Pos.Column)
+		}
+	}
+
+	if len(l.Errors()) != 0 {
+		t.Errorf("unexpected lexer errors: %v", l.Errors())
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	l := New("let x = 1;\n/* never closed")
+
+	var tok token.Token
+	for tok = l.NextToken(); tok.Type != token.EOF && tok.Type != token.ILLEGAL; tok = l.NextToken() {
+	}
+
+	if tok.Type != token.ILLEGAL {
+		t.Fatalf("tokentype wrong; expected: %q, got: %q", token.ILLEGAL, tok.Type)
+	}
+
+	expected := "2:1: unterminated block comment"
+	if len(l.Errors()) != 1 || l.Errors()[0] != expected {
+		t.Fatalf("wrong lexer errors; expected: [%q], got: %q", expected, l.Errors())
+	}
+
+	// Nothing after the broken comment can be read
+	if next := l.NextToken(); next.Type != token.EOF {
+		t.Errorf("tokentype wrong; expected: %q, got: %q", token.EOF, next.Type)
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	input := `let café = "héllo, 世界";
+変数 + "👋"`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedColumn  int
+	}{
+		{token.LET, "let", 1},
+		{token.IDENT, "café", 5},
+		{token.ASSIGN, "=", 10},
+		{token.STRING, "héllo, 世界", 12},
+		{token.SEMICOLON, ";", 23},
+		{token.IDENT, "変数", 1},
+		{token.PLUS, "+", 4},
+		{token.STRING, "👋", 6},
+		{token.EOF, "", 9},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong; expected: %q, got: %q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong; expected: %q, got: %q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		// Columns count characters, not bytes
+		if tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - column wrong; expected: %d, got: %d", i, tt.expectedColumn, tok.Pos.Column)
+		}
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLiteral string
+	}{
+		{`"plain"`, "plain"},
+		{`"a\nb"`, "a\nb"},
+		{`"a\tb"`, "a\tb"},
+		{`"back\\slash"`, `back\slash`},
+		{`"say \"hi\""`, `say "hi"`},
+		{`"\u{48}\u{49}"`, "HI"},
+		{`"\u{e9}t\u{E9}"`, "été"},
+		{`"\u{1F44B}"`, "👋"},
+		{"`raw \\n \"string\"`", `raw \n "string"`},
+		{"`multi\nline`", "multi\nline"},
+		{"``", ""},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != token.STRING {
+			t.Fatalf("tests[%d] - tokentype wrong; expected: %q, got: %q (errors: %v)", i, token.STRING, tok.Type, l.Errors())
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - literal wrong; expected: %q, got: %q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Errorf("tests[%d] - expected EOF after the string, got: %q", i, next.Type)
+		}
+	}
+}
+
+func TestBrokenStringLiterals(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{`"never closed`, "1:1: unterminated string literal"},
+		{"let s = `never\nclosed", "1:9: unterminated raw string literal"},
+		{`"bad \q escape"`, "1:6: invalid escape sequence in string literal"},
+		{`"\u{}"`, "1:2: invalid escape sequence in string literal"},
+		{`"\u{110000}"`, "1:2: invalid escape sequence in string literal"},
+		{`"\u{zz}"`, "1:2: invalid escape sequence in string literal"},
+		{`"\u48"`, "1:2: invalid escape sequence in string literal"},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+
+		var tok token.Token
+		for tok = l.NextToken(); tok.Type != token.EOF && tok.Type != token.ILLEGAL; tok = l.NextToken() {
+		}
+
+		if tok.Type != token.ILLEGAL {
+			t.Errorf("tests[%d] - tokentype wrong; expected: %q, got: %q", i, token.ILLEGAL, tok.Type)
+		}
+
+		if len(l.Errors()) == 0 || l.Errors()[0] != tt.expectedError {
+			t.Errorf("tests[%d] - wrong lexer errors; expected: %q first, got: %q", i, tt.expectedError, l.Errors())
+		}
+	}
+}
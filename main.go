@@ -1,13 +1,51 @@
 package main
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
 	"os"
 	"os/user"
+	"path/filepath"
+	"s8/compiler"
+	"s8/disasm"
 	"s8/repl"
+	"s8/runner"
+	"strings"
 )
 
+const usage = `Usage:
+	s8                                             start the REPL
+	s8 run [--engine=vm|eval] [--optimize] <file>  run a script file, or a compiled .s8c file on the VM
+	s8 compile [-o <out.s8c>] [--optimize] <file>  compile a script file to bytecode
+	s8 disasm [--optimize] <file>                  print the bytecode of a script or .s8c file
+`
+
+// Extension of compiled bytecode files
+const bytecodeExt = ".s8c"
+
 func main() {
+	if len(os.Args) < 2 {
+		startRepl()
+		return
+	}
+
+	switch os.Args[1] {
+	case "run":
+		os.Exit(runFile(os.Args[2:]))
+	case "compile":
+		os.Exit(compileFile(os.Args[2:]))
+	case "disasm":
+		os.Exit(disassembleFile(os.Args[2:]))
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+}
+
+func startRepl() {
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -16,3 +54,164 @@ func main() {
 	fmt.Printf("Feel free to type in commands\n")
 	repl.Start(os.Stdin, os.Stdout)
 }
+
+// Run a script and return the exit status of the process
+func runFile(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	engine := fs.String("engine", runner.EngineVM, "use 'vm' or 'eval'")
+	optimize := fs.Bool("optimize", false, "optimize the bytecode for the vm engine")
+
+	filename, ok := parseArgs(fs, args)
+	if !ok {
+		return 2
+	}
+	if *optimize && *engine != runner.EngineVM {
+		fmt.Fprintf(os.Stderr, "--optimize only applies to the %s engine\n", runner.EngineVM)
+		return 2
+	}
+
+	input, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+
+	if filepath.Ext(filename) == bytecodeExt {
+		if *engine != runner.EngineVM {
+			fmt.Fprintf(os.Stderr, "%s files can only run on the %s engine\n", bytecodeExt, runner.EngineVM)
+			return 2
+		}
+		return runBytecode(filename, input)
+	}
+
+	if *optimize {
+		var bytecode *compiler.Bytecode
+		bytecode, err = runner.Compile(filename, string(input), true)
+		if err == nil {
+			_, err = runner.RunBytecode(bytecode)
+		}
+	} else {
+		_, err = runner.Run(filename, string(input), *engine)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+func runBytecode(filename string, input []byte) int {
+	bytecode, err := compiler.Decode(bytes.NewReader(input))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", filename, err)
+		return 1
+	}
+
+	_, err = runner.RunBytecode(bytecode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// Compile a script to a .s8c file and return the exit status of the process
+func compileFile(args []string) int {
+	fs := flag.NewFlagSet("compile", flag.ContinueOnError)
+	output := fs.String("o", "", "where to write the bytecode (default: the file name with a "+bytecodeExt+" extension)")
+	optimize := fs.Bool("optimize", false, "optimize the bytecode")
+
+	filename, ok := parseArgs(fs, args)
+	if !ok {
+		return 2
+	}
+	if *output == "" {
+		*output = strings.TrimSuffix(filename, filepath.Ext(filename)) + bytecodeExt
+	}
+
+	input, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+
+	bytecode, err := runner.Compile(filename, string(input), *optimize)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+
+	var buf bytes.Buffer
+	err = bytecode.Encode(&buf)
+	if err == nil {
+		err = os.WriteFile(*output, buf.Bytes(), 0o644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// Print the bytecode of a script, or of a compiled .s8c file,
+// and return the exit status of the process
+func disassembleFile(args []string) int {
+	fs := flag.NewFlagSet("disasm", flag.ContinueOnError)
+	optimize := fs.Bool("optimize", false, "show the optimized bytecode")
+
+	filename, ok := parseArgs(fs, args)
+	if !ok {
+		return 2
+	}
+
+	input, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+
+	var bytecode *compiler.Bytecode
+	if filepath.Ext(filename) == bytecodeExt {
+		bytecode, err = compiler.Decode(bytes.NewReader(input))
+		if err != nil {
+			err = fmt.Errorf("%s: %w", filename, err)
+		}
+	} else {
+		bytecode, err = runner.Compile(filename, string(input), *optimize)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+
+	fmt.Print(disasm.Disassemble(bytecode))
+	return 0
+}
+
+// Parse the flags of a command that takes a single file name.
+// Flags are allowed after the file name too, e.g., s8 run file.s8 --engine=eval
+func parseArgs(fs *flag.FlagSet, args []string) (string, bool) {
+	if err := fs.Parse(args); err != nil {
+		return "", false
+	}
+
+	filename := fs.Arg(0)
+	if fs.NArg() > 1 {
+		if err := fs.Parse(fs.Args()[1:]); err != nil {
+			return "", false
+		}
+		if fs.NArg() > 0 {
+			fmt.Fprintf(os.Stderr, "too many arguments: %v\n%s", fs.Args(), usage)
+			return "", false
+		}
+	}
+	if filename == "" {
+		fmt.Fprint(os.Stderr, usage)
+		return "", false
+	}
+
+	return filename, true
+}
@@ -3,6 +3,7 @@ package object
 import (
 	"fmt"
 	"math"
+	"sort"
 )
 
 var Builtins = []struct {
@@ -12,15 +13,20 @@ var Builtins = []struct {
 	{
 		"len",
 		&Builtin{
+			Receivers: []ObjectType{STRING_OBJ, ARRAY_OBJ, HASH_OBJ, TUPLE_OBJ},
 			Fn: func(args ...Object) Object {
 				if len(args) != 1 {
 					return newError("wrong number of arguments. got=%d, want=1", len(args))
 				}
 				switch arg := args[0].(type) {
 				case *String:
-					return &Integer{Value: int64(len(arg.Value))}
+					return NewInteger(int64(arg.Len()))
 				case *Array:
-					return &Integer{Value: int64(len(arg.Elements))}
+					return NewInteger(int64(len(arg.Elements)))
+				case *Tuple:
+					return NewInteger(int64(len(arg.Elements)))
+				case *Hash:
+					return NewInteger(int64(len(arg.Pairs)))
 				default:
 					return newError("argument to `len` not supported, got %s", args[0].Type())
 				}
@@ -42,6 +48,7 @@ var Builtins = []struct {
 	{
 		"first",
 		&Builtin{
+			Receivers: []ObjectType{ARRAY_OBJ},
 			Fn: func(args ...Object) Object {
 				if len(args) != 1 {
 					return newError("wrong number of arguments. got=%d, want=1", len(args))
@@ -60,9 +67,10 @@ var Builtins = []struct {
 	{
 		"last",
 		&Builtin{
+			Receivers: []ObjectType{ARRAY_OBJ},
 			Fn: func(args ...Object) Object {
 				if len(args) != 1 {
-					return newError("wrong number of arguments. got: %d, want: 1", len(args))
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
 				}
 				if args[0].Type() != ARRAY_OBJ {
 					return newError("argument to `last` must be ARRAY, got %s", args[0].Type())
@@ -80,9 +88,10 @@ var Builtins = []struct {
 		// Exclude the 1st elem
 		"rest",
 		&Builtin{
+			Receivers: []ObjectType{ARRAY_OBJ},
 			Fn: func(args ...Object) Object {
 				if len(args) != 1 {
-					return newError("wrong number of arguments. got: %d, want: 1", len(args))
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
 				}
 				if args[0].Type() != ARRAY_OBJ {
 					return newError("argument to `rest` must be of ARRAY type, got %s", args[0].Type())
@@ -102,9 +111,10 @@ var Builtins = []struct {
 	{
 		"push",
 		&Builtin{
+			Receivers: []ObjectType{ARRAY_OBJ},
 			Fn: func(args ...Object) Object {
 				if len(args) != 2 {
-					return newError("wrong number of arguments. got: %d, want: 2", len(args))
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
 				}
 				if args[0].Type() != ARRAY_OBJ {
 					return newError("argument to `push` must be ARRAY, got %s", args[0].Type())
@@ -123,9 +133,10 @@ var Builtins = []struct {
 	{
 		"power",
 		&Builtin{
+			Receivers: []ObjectType{INTERGER_OBJ},
 			Fn: func(args ...Object) Object {
 				if len(args) != 2 {
-					return newError("wrong number of arguments for power. got: %d, want: 2", len(args))
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
 				}
 				if args[0].Type() != INTERGER_OBJ || args[1].Type() != INTERGER_OBJ {
 					return newError("argument to power must of of INTEGER type, got: %s (1st argument) | %s (2nd argument)", args[0].Type(), args[1].Type())
@@ -136,13 +147,80 @@ var Builtins = []struct {
 				result := math.Pow(float64(base.Value), float64(exponent.Value))
 				// Check if the result has no decimal part
 				if result == float64(int64(result)) {
-					return &Integer{Value: int64(result)}
+					return NewInteger(int64(result))
 				}
 				return &Float{Value: result}
 			},
 			// TODO: Add round and format
 		},
 	},
+	{
+		// Raise an error with the given message, to be caught by try/catch
+		"error",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				msg, ok := args[0].(*String)
+				if !ok {
+					return newError("argument to `error` must be STRING, got %s", args[0].Type())
+				}
+				return newError("%s", msg.Value)
+			},
+		},
+	},
+	{
+		"keys",
+		&Builtin{
+			Receivers: []ObjectType{HASH_OBJ},
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				hash, ok := args[0].(*Hash)
+				if !ok {
+					return newError("argument to `keys` must be HASH, got %s", args[0].Type())
+				}
+
+				keys := make([]Object, 0, len(hash.Pairs))
+				for _, pair := range hash.Pairs {
+					keys = append(keys, pair.Key)
+				}
+				// Go maps have no order, sort so the result is always the same
+				sort.Slice(keys, func(i, j int) bool {
+					return keys[i].Inspect() < keys[j].Inspect()
+				})
+				return &Array{Elements: keys}
+			},
+		},
+	},
+}
+
+// The builtins that can be called as methods of each type, e.g. arr.push(4) for push(arr, 4)
+var methods = buildMethods()
+
+func buildMethods() map[ObjectType]map[string]*Builtin {
+	table := map[ObjectType]map[string]*Builtin{}
+	for _, def := range Builtins {
+		for _, typ := range def.Builtin.Receivers {
+			if table[typ] == nil {
+				table[typ] = map[string]*Builtin{}
+			}
+			table[typ][def.Name] = def.Builtin
+		}
+	}
+	return table
+}
+
+// Return the method of the receiver with the given name bound to the receiver,
+// or nil if its type has no such method
+func GetMethod(receiver Object, name string) *BoundMethod {
+	builtin, ok := methods[receiver.Type()][name]
+	if !ok {
+		return nil
+	}
+	return &BoundMethod{Name: name, Receiver: receiver, Builtin: builtin}
 }
 
 func newError(format string, a ...any) *Error {
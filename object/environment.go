@@ -41,3 +41,18 @@ func (e *Environment) Set(name string, obj Object) Object {
 	e.store[name] = obj
 	return obj
 }
+
+// Update an existing binding in the environment it was defined in.
+// Unlike Set, this never creates a new binding in the current environment
+func (e *Environment) Assign(name string, obj Object) (Object, bool) {
+	if _, ok := e.store[name]; ok {
+		e.store[name] = obj
+		return obj, true
+	}
+
+	if e.outer != nil {
+		return e.outer.Assign(name, obj)
+	}
+
+	return nil, false
+}
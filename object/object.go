@@ -2,12 +2,16 @@ package object
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"hash/fnv"
+	"math"
 	"strings"
+	"unicode/utf8"
 
 	"s8/ast"
 	"s8/code"
+	"s8/token"
 )
 
 type ObjectType string
@@ -23,17 +27,22 @@ const (
 	FUNCTION_OBJ     = "FUNCTION"
 	STRING_OBJ       = "STRING"
 	BUILTIN_OBJ      = "BUILTIN"
+	BOUND_METHOD_OBJ = "BOUND_METHOD"
 	ARRAY_OBJ        = "ARRAY"
+	TUPLE_OBJ        = "TUPLE"
 	HASH_OBJ         = "HASH"
 	IDENT_OBJ        = "IDENTIFIER"
 	QUOTE_OBJ        = "QUOTE"
 	MACRO_OBJ        = "MACRO"
 	BREAK_OBJ        = "BREAK"
 	CONTINUE_OBJ     = "CONTINUE"
+	STRUCT_TYPE_OBJ  = "STRUCT_TYPE"
+	STRUCT_OBJ       = "STRUCT"
 	// Hold the instructions of a compiled function
 	// then we pass it as a constant
 	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
 	CLOSURE_OBJ           = "CLOSURE"
+	CELL_OBJ              = "CELL"
 )
 
 // Interface instead of struct
@@ -51,6 +60,30 @@ func (i *Integer) Inspect() string { return fmt.Sprintf("%d", i.Value) }
 
 func (i *Integer) Type() ObjectType { return INTERGER_OBJ }
 
+// Integers in this range are allocated once and shared,
+// since counters, indexes and small results make up most of the integers a program creates
+const (
+	minCachedInteger = -128
+	maxCachedInteger = 1024
+)
+
+var integerCache = func() []*Integer {
+	cache := make([]*Integer, maxCachedInteger-minCachedInteger+1)
+	for i := range cache {
+		cache[i] = &Integer{Value: int64(i + minCachedInteger)}
+	}
+	return cache
+}()
+
+// Return an integer object for value, shared with every other integer of the same value
+// if it is small. Integers are never modified once created, so sharing them is safe
+func NewInteger(value int64) *Integer {
+	if value >= minCachedInteger && value <= maxCachedInteger {
+		return integerCache[value-minCachedInteger]
+	}
+	return &Integer{Value: value}
+}
+
 type Float struct {
 	Value float64
 }
@@ -59,6 +92,44 @@ func (f *Float) Inspect() string { return fmt.Sprintf("%f", f.Value) }
 
 func (f *Float) Type() ObjectType { return FLOAT_OBJ }
 
+// Shared by the evaluator and the VM so both engines round floats the same way
+const (
+	// Two floats closer than this are considered equal
+	FloatEpsilon = 0.000001
+	// Number of decimal places we keep for float literals, sums and quotients
+	FloatPrecision = 6
+)
+
+// Round a floating-point number to the nearest integer
+//
+//	Examples:
+//
+// - round(3.7) → 3.7 + 0.5 = 4.2 → 4
+// - round(3.2) → 3.2 + 0.5 = 3.7 → 3
+// - round(-3.7) → -3.7 - 0.5 = -4.2 → -4
+func round(value float64) int {
+	return int(value + math.Copysign(0.5, value))
+}
+
+// Round a floating-point number to a specified number of decimal places (precision)
+func ToFixed(value float64, precision int) float64 {
+	output := math.Pow(10, float64(precision))
+	return float64(round(value*output)) / output
+}
+
+// Promote an integer to a float so mixed operands can be computed as floats.
+// Floats are returned as they are
+func ToFloat(obj Object) *Float {
+	switch obj := obj.(type) {
+	case *Integer:
+		return &Float{Value: float64(obj.Value)}
+	case *Float:
+		return obj
+	default:
+		return nil
+	}
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -95,14 +166,35 @@ func (c *Continue) Inspect() string { return "continue" }
 
 type Error struct {
 	Message string
+	// Where the error was raised, set by the evaluator
+	Pos token.Position
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
 
-func (e *Error) Inspect() string { return "ERROR: " + e.Message }
+func (e *Error) Inspect() string {
+	if !e.Pos.IsValid() {
+		return "ERROR: " + e.Message
+	}
+	return "ERROR: " + e.Pos.String() + ": " + e.Message
+}
+
+// Turn a caught error into a plain value that scripts can look into,
+// e.g. e["message"] inside a catch block
+func (e *Error) Value() *Hash {
+	key := &String{Value: "message"}
+	msg := &String{Value: e.Message}
+
+	return &Hash{Pairs: map[HashKey]HashPair{
+		key.HashKey(): {Key: key, Value: msg},
+	}}
+}
 
 type Function struct {
 	Parameters []*ast.Identifier
+	Defaults   []ast.Expression // Evaluated when a call leaves out their parameters
+	Rest       *ast.Identifier
+	Patterns   []ast.Pattern // Take apart the arguments of the parameters named after them
 	Body       *ast.BlockStatement
 	Env        *Environment // A function's very own environment
 }
@@ -112,15 +204,9 @@ func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
 func (f *Function) Inspect() string {
 	var out bytes.Buffer
 
-	params := []string{}
-
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
-	}
-
 	out.WriteString("funk")
 	out.WriteString("(")
-	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(ast.ParametersString(f.Parameters, f.Defaults, f.Rest))
 
 	out.WriteString(") {\n")
 	out.WriteString(f.Body.String())
@@ -137,16 +223,75 @@ func (s *String) Type() ObjectType { return STRING_OBJ }
 
 func (s *String) Inspect() string { return s.Value }
 
+// Strings are measured and indexed by characters (runes), not bytes
+func (s *String) Len() int { return utf8.RuneCountInString(s.Value) }
+
+// Return the character at index i as a string, or false if i is out of range
+func (s *String) CharAt(i int64) (*String, bool) {
+	if i < 0 {
+		return nil, false
+	}
+
+	var n int64
+	for _, ch := range s.Value {
+		if n == i {
+			if ch < utf8.RuneSelf {
+				return asciiStrings[ch], true
+			}
+			return &String{Value: string(ch)}, true
+		}
+		n++
+	}
+
+	return nil, false
+}
+
+// Strings of one ASCII character, shared like small integers,
+// since walking through a string one character at a time creates a lot of them
+var asciiStrings = func() []*String {
+	cache := make([]*String, utf8.RuneSelf)
+	for i := range cache {
+		cache[i] = &String{Value: string(rune(i))}
+	}
+	return cache
+}()
+
+// Return left + right. Strings are never modified once created,
+// so adding an empty string returns the other one instead of a copy
+func ConcatStrings(left, right *String) *String {
+	switch {
+	case left.Value == "":
+		return right
+	case right.Value == "":
+		return left
+	default:
+		return &String{Value: left.Value + right.Value}
+	}
+}
+
 type BuiltinFunction func(args ...Object) Object
 
 type Builtin struct {
 	Fn BuiltinFunction
+	// The types whose values can call the builtin as a method, passing themselves as the first argument
+	Receivers []ObjectType
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
 
 func (b *Builtin) Inspect() string { return "builtin function" }
 
+// A builtin called as a method, which gets the receiver as its first argument
+type BoundMethod struct {
+	Name     string
+	Receiver Object
+	Builtin  *Builtin
+}
+
+func (bm *BoundMethod) Type() ObjectType { return BOUND_METHOD_OBJ }
+
+func (bm *BoundMethod) Inspect() string { return "builtin method " + bm.Name }
+
 type Array struct {
 	Elements []Object
 }
@@ -169,6 +314,80 @@ func (a *Array) Inspect() string {
 	return out.String()
 }
 
+// An immutable list of values, e.g. (1, "a", true)
+type Tuple struct {
+	Elements []Object
+}
+
+func (t *Tuple) Type() ObjectType { return TUPLE_OBJ }
+
+func (t *Tuple) Inspect() string {
+	elems := []string{}
+	for _, e := range t.Elements {
+		elems = append(elems, e.Inspect())
+	}
+	// Like in the source code, (1,) is a tuple and (1) is not
+	if len(elems) == 1 {
+		return "(" + elems[0] + ",)"
+	}
+	return "(" + strings.Join(elems, ", ") + ")"
+}
+
+// Return the elements of a tuple destructured into n names, or describe why it cannot be.
+// Both engines destructure tuples with this, so they report the same errors
+func TupleElements(obj Object, n int) ([]Object, string) {
+	tuple, ok := obj.(*Tuple)
+	if !ok {
+		return nil, fmt.Sprintf("cannot destructure %s as a tuple", obj.Type())
+	}
+	if len(tuple.Elements) != n {
+		return nil, fmt.Sprintf("wrong number of values to destructure: want=%d, got=%d", n, len(tuple.Elements))
+	}
+	return tuple.Elements, ""
+}
+
+// Like TupleElements, for an array destructured into n names followed by a rest name if rest is set,
+// which gets an array of the elements left over
+func ArrayElements(obj Object, n int, rest bool) ([]Object, string) {
+	array, ok := obj.(*Array)
+	if !ok {
+		return nil, fmt.Sprintf("cannot destructure %s as an array", obj.Type())
+	}
+
+	got := len(array.Elements)
+	if !rest && got != n {
+		return nil, fmt.Sprintf("wrong number of values to destructure: want=%d, got=%d", n, got)
+	}
+	if rest && got < n {
+		return nil, fmt.Sprintf("wrong number of values to destructure: want at least %d, got=%d", n, got)
+	}
+
+	if !rest {
+		return array.Elements, ""
+	}
+	elements := append([]Object{}, array.Elements[:n]...)
+	leftOver := append([]Object{}, array.Elements[n:]...)
+	return append(elements, &Array{Elements: leftOver}), ""
+}
+
+// Like TupleElements, for a hash destructured into the values of the given string keys
+func HashValues(obj Object, keys []string) ([]Object, string) {
+	hash, ok := obj.(*Hash)
+	if !ok {
+		return nil, fmt.Sprintf("cannot destructure %s as a hash", obj.Type())
+	}
+
+	values := make([]Object, len(keys))
+	for i, key := range keys {
+		pair, ok := hash.Pairs[(&String{Value: key}).HashKey()]
+		if !ok {
+			return nil, fmt.Sprintf("no key %q in the hash to destructure", key)
+		}
+		values[i] = pair.Value
+	}
+	return values, ""
+}
+
 // Help keys of the same type sharing the same hash pointing to the same memory location
 // Example: {"FB": 1, "Ea": 2} and hash("FB") == hash("Ea")
 // as they produce identical hash value
@@ -205,6 +424,20 @@ func (s *String) HashKey() HashKey {
 	return HashKey{Type: s.Type(), Value: h.Sum64()}
 }
 
+// Combine the hash keys of the elements.
+// Only tuples AsHashable accepts have one
+func (t *Tuple) HashKey() HashKey {
+	h := fnv.New64a()
+
+	for _, e := range t.Elements {
+		key := e.(Hashable).HashKey()
+		h.Write([]byte(key.Type))
+		h.Write(binary.BigEndian.AppendUint64(nil, key.Value))
+	}
+
+	return HashKey{Type: t.Type(), Value: h.Sum64()}
+}
+
 // Responsible for generating the HashKey
 type HashPair struct {
 	Key   Object // Original key object
@@ -251,12 +484,85 @@ func (h *Hash) Inspect() string {
 	return out.String()
 }
 
+// A type declared with struct, e.g. struct Point { x, y }
+type StructType struct {
+	Name   string
+	Fields []string
+}
+
+func (st *StructType) Type() ObjectType { return STRUCT_TYPE_OBJ }
+
+func (st *StructType) Inspect() string {
+	return "struct " + st.Name + " " + braces(st.Fields)
+}
+
+// Return where a field is kept in the values of the structs of this type,
+// or -1 if there is no such field
+func (st *StructType) FieldIndex(name string) int {
+	for i, field := range st.Fields {
+		if field == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// An instance of a struct type, with a value for each field in the order they are declared in
+type Struct struct {
+	Def    *StructType
+	Values []Object
+}
+
+func (s *Struct) Type() ObjectType { return STRUCT_OBJ }
+
+// Show the struct the way it would be written in the source code, e.g. Point { x: 1, label: "a" }
+func (s *Struct) Inspect() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for i, field := range s.Def.Fields {
+		value := s.Values[i].Inspect()
+		if str, ok := s.Values[i].(*String); ok {
+			value = fmt.Sprintf("%q", str.Value)
+		}
+		pairs = append(pairs, field+": "+value)
+	}
+
+	out.WriteString(s.Def.Name)
+	out.WriteString(" ")
+	out.WriteString(braces(pairs))
+
+	return out.String()
+}
+
+func braces(items []string) string {
+	if len(items) == 0 {
+		return "{}"
+	}
+	return "{ " + strings.Join(items, ", ") + " }"
+}
+
 // Since the hash key could be of any type,
 // check if the given object could be used as a hash key
 type Hashable interface {
 	HashKey() HashKey
 }
 
+// Return obj as a Hashable if it can be used as a hash key.
+// Tuples can only if all of their elements can
+func AsHashable(obj Object) (Hashable, bool) {
+	if tuple, ok := obj.(*Tuple); ok {
+		for _, e := range tuple.Elements {
+			if _, ok := AsHashable(e); !ok {
+				return nil, false
+			}
+		}
+	}
+
+	key, ok := obj.(Hashable)
+	return key, ok
+}
+
 type Quote struct {
 	// When we evaluate a call to quote
 	// We can prevent the argument (as a call) from being evaluated immediately
@@ -302,10 +608,38 @@ type CompiledFunction struct {
 	// The number of local bindings the function is going to create
 	NumLocals     int
 	NumParameters int
+	// How many of the last parameters have a default value
+	NumDefaults int
+	// Collects the arguments after the parameters into an array,
+	// in the local right after them
+	Variadic bool
+	// Where the instructions come from in the source code, for runtime errors
+	SourceMap code.SourceMap
+	// The name the function was bound to with let, empty for anonymous functions
+	Name string
 }
 
 func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
 
+// Describe what is wrong with calling a function with numArgs arguments, or return "" if nothing is.
+// The function takes params parameters, the last optional of which have a default value,
+// and any number of arguments after them if it has a rest parameter.
+// Both engines check calls with this, so they report the same errors
+func ArityError(params, optional int, rest bool, numArgs int) string {
+	required := params - optional
+
+	switch {
+	case numArgs >= required && (rest || numArgs <= params):
+		return ""
+	case rest:
+		return fmt.Sprintf("wrong number of arguments. got=%d, want at least %d", numArgs, required)
+	case optional > 0:
+		return fmt.Sprintf("wrong number of arguments. got=%d, want=%d to %d", numArgs, required, params)
+	default:
+		return fmt.Sprintf("wrong number of arguments. got=%d, want=%d", numArgs, params)
+	}
+}
+
 func (cf *CompiledFunction) Inspect() string {
 	return fmt.Sprintf("CompiledFunction[%p]", cf)
 }
@@ -319,3 +653,13 @@ type Closure struct {
 
 func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
 func (c *Closure) Inspect() string  { return fmt.Sprintf("Closure[%p]", c) }
+
+// Holds a variable captured by a closure, so the closure and the function it was created in
+// see each other's assignments to it, like functions sharing an *object.Environment do.
+// Only the VM uses cells, they are never the value of an expression
+type Cell struct {
+	Value Object
+}
+
+func (c *Cell) Type() ObjectType { return CELL_OBJ }
+func (c *Cell) Inspect() string  { return c.Value.Inspect() }
@@ -21,3 +21,169 @@ func TestStringHasKey(t *testing.T) {
 		t.Errorf("strings with different content but have same hash keys")
 	}
 }
+
+func TestNewInteger(t *testing.T) {
+	for _, value := range []int64{minCachedInteger, -1, 0, 1, maxCachedInteger} {
+		if NewInteger(value) != NewInteger(value) {
+			t.Errorf("integer %d is not cached", value)
+		}
+		if NewInteger(value).Value != value {
+			t.Errorf("wrong value. want=%d, got=%d", value, NewInteger(value).Value)
+		}
+	}
+
+	for _, value := range []int64{minCachedInteger - 1, maxCachedInteger + 1} {
+		if NewInteger(value) == NewInteger(value) {
+			t.Errorf("integer %d is cached", value)
+		}
+	}
+}
+
+func TestConcatStrings(t *testing.T) {
+	empty := &String{Value: ""}
+	hello := &String{Value: "hello"}
+
+	if ConcatStrings(hello, empty) != hello || ConcatStrings(empty, hello) != hello {
+		t.Errorf("adding an empty string made a copy")
+	}
+
+	result := ConcatStrings(hello, &String{Value: " world"})
+	if result.Value != "hello world" {
+		t.Errorf("wrong value. want=%q, got=%q", "hello world", result.Value)
+	}
+	if hello.Value != "hello" {
+		t.Errorf("operand was modified. got=%q", hello.Value)
+	}
+}
+
+func TestCharAtSharesASCII(t *testing.T) {
+	s := &String{Value: "aé a"}
+
+	first, _ := s.CharAt(0)
+	last, _ := s.CharAt(3)
+	if first != last {
+		t.Errorf("ASCII characters are not shared")
+	}
+
+	accented, ok := s.CharAt(1)
+	if !ok || accented.Value != "é" {
+		t.Errorf("wrong character. want=%q, got=%v", "é", accented)
+	}
+}
+
+func TestStructInspect(t *testing.T) {
+	point := &StructType{Name: "Point", Fields: []string{"x", "label"}}
+	empty := &StructType{Name: "Empty", Fields: []string{}}
+
+	tests := []struct {
+		obj      Object
+		expected string
+	}{
+		{point, "struct Point { x, label }"},
+		{empty, "struct Empty {}"},
+		{&Struct{Def: point, Values: []Object{NewInteger(1), &String{Value: "a \"b\""}}}, `Point { x: 1, label: "a \"b\"" }`},
+		{&Struct{Def: empty, Values: []Object{}}, "Empty {}"},
+	}
+
+	for _, tt := range tests {
+		if tt.obj.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect. want=%q, got=%q", tt.expected, tt.obj.Inspect())
+		}
+	}
+
+	if point.FieldIndex("label") != 1 || point.FieldIndex("y") != -1 {
+		t.Errorf("wrong field indexes. got=%d, %d", point.FieldIndex("label"), point.FieldIndex("y"))
+	}
+}
+
+func TestGetMethod(t *testing.T) {
+	arr := &Array{Elements: []Object{NewInteger(1)}}
+
+	method := GetMethod(arr, "push")
+	if method == nil {
+		t.Fatalf("arrays have no push method")
+	}
+	if method.Receiver != arr || method.Builtin != GetBuiltinByName("push") {
+		t.Errorf("push is not bound to the array. got=%+v", method)
+	}
+
+	if GetMethod(arr, "keys") != nil {
+		t.Errorf("arrays have a keys method")
+	}
+	if GetMethod(&Hash{}, "keys") == nil {
+		t.Errorf("hashes have no keys method")
+	}
+
+	// Every builtin is a method of the types it lists as receivers
+	for _, def := range Builtins {
+		for _, typ := range def.Builtin.Receivers {
+			if methods[typ][def.Name] != def.Builtin {
+				t.Errorf("%s has no %s method", typ, def.Name)
+			}
+		}
+	}
+}
+
+func TestTupleHashKey(t *testing.T) {
+	pair1 := &Tuple{Elements: []Object{NewInteger(1), &String{Value: "a"}}}
+	pair2 := &Tuple{Elements: []Object{NewInteger(1), &String{Value: "a"}}}
+	swapped := &Tuple{Elements: []Object{&String{Value: "a"}, NewInteger(1)}}
+	nested := &Tuple{Elements: []Object{pair1, &Boolean{Value: true}}}
+
+	if pair1.HashKey() != pair2.HashKey() {
+		t.Errorf("tuples with same content but have different hash keys")
+	}
+	if pair1.HashKey() == swapped.HashKey() {
+		t.Errorf("tuples with elements in a different order but have same hash keys")
+	}
+	if _, ok := AsHashable(nested); !ok {
+		t.Errorf("tuple of hashable values is not hashable")
+	}
+
+	withArray := &Tuple{Elements: []Object{NewInteger(1), &Array{Elements: []Object{}}}}
+	if _, ok := AsHashable(withArray); ok {
+		t.Errorf("tuple holding an array is hashable")
+	}
+
+	if pair1.Inspect() != "(1, a)" || (&Tuple{Elements: []Object{NewInteger(1)}}).Inspect() != "(1,)" {
+		t.Errorf("wrong Inspect. got=%q", pair1.Inspect())
+	}
+}
+
+func TestDestructureShapes(t *testing.T) {
+	array := &Array{Elements: []Object{NewInteger(1), NewInteger(2), NewInteger(3)}}
+
+	parts, msg := ArrayElements(array, 1, true)
+	if msg != "" || len(parts) != 2 || parts[1].Inspect() != "[2, 3]" {
+		t.Errorf("wrong parts with rest. got=%v, %q", parts, msg)
+	}
+	// The rest is a new array
+	parts[1].(*Array).Elements[0] = NewInteger(9)
+	if array.Elements[1].Inspect() != "2" {
+		t.Errorf("rest shares its elements with the array")
+	}
+
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	key := &String{Value: "name"}
+	hash.Pairs[key.HashKey()] = HashPair{Key: key, Value: &String{Value: "Mo"}}
+
+	tests := []struct {
+		parts    func() ([]Object, string)
+		expected string
+	}{
+		{func() ([]Object, string) { return ArrayElements(array, 2, false) }, "wrong number of values to destructure: want=2, got=3"},
+		{func() ([]Object, string) { return ArrayElements(array, 4, true) }, "wrong number of values to destructure: want at least 4, got=3"},
+		{func() ([]Object, string) { return ArrayElements(hash, 1, false) }, "cannot destructure HASH as an array"},
+		{func() ([]Object, string) { return HashValues(hash, []string{"name", "age"}) }, `no key "age" in the hash to destructure`},
+		{func() ([]Object, string) { return HashValues(array, []string{"name"}) }, "cannot destructure ARRAY as a hash"},
+		{func() ([]Object, string) { return TupleElements(array, 3) }, "cannot destructure ARRAY as a tuple"},
+		{func() ([]Object, string) { return HashValues(hash, []string{"name"}) }, ""},
+	}
+
+	for _, tt := range tests {
+		_, msg := tt.parts()
+		if msg != tt.expected {
+			t.Errorf("wrong message. want=%q, got=%q", tt.expected, msg)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package object
+
+import (
+	"math"
+
+	"s8/ast"
+)
+
+// To NOT create new instances of Boolean or Null and use reference instead
+// This improves performance too (pointer comparison is faster than value comparison)
+var (
+	NULL  = &Null{}
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+)
+
+// Take Go's native true and return singleton TRUE pointer
+func NativeBool(input bool) *Boolean {
+	if input {
+		return TRUE
+	}
+
+	return FALSE
+}
+
+// Only false and null are falsy
+func IsTruthy(obj Object) bool {
+	switch obj {
+	case NULL:
+		return false
+	case TRUE:
+		return true
+	case FALSE:
+		return false
+	default:
+		return true
+	}
+}
+
+func IsNumeric(obj Object) bool {
+	return obj.Type() == INTERGER_OBJ || obj.Type() == FLOAT_OBJ
+}
+
+// Apply a prefix operator to an evaluated operand.
+// ++ and -- are not handled here, since they need a variable to write to
+func PrefixOperator(operator string, right Object) Object {
+	switch operator {
+	case "!":
+		return bangOperator(right)
+	case "-":
+		return minusPrefixOperator(right)
+	case "~":
+		return bitwiseNotOperator(right)
+	default:
+		return newError("unknown operator:%s%s", operator, right.Type())
+	}
+}
+
+// The error for ++ and -- on an operand they cannot write back to, e.g. 5++.
+// Both engines report it without running the operand,
+// naming literals by their type and anything else by its source
+func IncrementError(operand ast.Expression) string {
+	var typ ObjectType
+	switch operand.(type) {
+	case *ast.IntegerLiteral:
+		typ = INTERGER_OBJ
+	case *ast.FloatLiteral:
+		typ = FLOAT_OBJ
+	case *ast.StringLiteral:
+		typ = STRING_OBJ
+	case *ast.Boolean:
+		typ = BOOLEAN_OBJ
+	case *ast.ArrayLiteral:
+		typ = ARRAY_OBJ
+	case *ast.HashLiteral:
+		typ = HASH_OBJ
+	case *ast.TupleLiteral:
+		typ = TUPLE_OBJ
+	case *ast.FunctionLiteral:
+		typ = FUNCTION_OBJ
+	default:
+		return "cannot increment non-identifier: " + operand.String()
+	}
+	return "cannot increment non-identifier: " + string(typ)
+}
+
+// Apply an infix operator to evaluated operands.
+// && and || take both operands here, it is up to the caller to skip the right one
+func InfixOperator(operator string, left, right Object) Object {
+	switch {
+	case operator == "&&":
+		return NativeBool(IsTruthy(left) && IsTruthy(right))
+	case operator == "||":
+		return NativeBool(IsTruthy(left) || IsTruthy(right))
+	// We cannot use pointer comparison here
+	// Since we are always allocating NEW instances of Integer
+	case left.Type() == INTERGER_OBJ && right.Type() == INTERGER_OBJ:
+		return integerInfixOperator(operator, left, right)
+	case left.Type() == FLOAT_OBJ && right.Type() == FLOAT_OBJ:
+		return floatInfixOperator(operator, left, right)
+	// Mixed operands are promoted to floats e.g., 1 + 2.5 == 3.5
+	case IsNumeric(left) && IsNumeric(right):
+		return floatInfixOperator(operator, ToFloat(left), ToFloat(right))
+	case left.Type() == STRING_OBJ && right.Type() == STRING_OBJ:
+		return stringInfixOperator(operator, left, right)
+	case left.Type() == TUPLE_OBJ && right.Type() == TUPLE_OBJ:
+		return tupleInfixOperator(operator, left, right)
+		// For cases like TRUE == TRUE
+		// Here we use POINTER COMPARISON by comparing the memory addresses of two *Object pointers
+		// The result is a native Go boolean
+	case left.Type() != right.Type():
+		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	case operator == "==":
+		return NativeBool(left == right)
+	case operator == "!=":
+		return NativeBool(left != right)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func bangOperator(right Object) Object {
+	// If something has the SAME MEMORY ADDRESS value as boolean constants here, then it works
+	switch right {
+	case TRUE:
+		return FALSE
+	case FALSE:
+		return TRUE
+	case NULL:
+		return TRUE
+	default:
+		return FALSE
+	}
+}
+
+func minusPrefixOperator(right Object) Object {
+	switch right.Type() {
+	case INTERGER_OBJ:
+		value := right.(*Integer).Value
+		return NewInteger(-value)
+	case FLOAT_OBJ:
+		value := right.(*Float).Value
+		return &Float{Value: -value}
+	default:
+		return newError("unknown operator: -%s", right.Type())
+	}
+}
+
+func bitwiseNotOperator(right Object) Object {
+	if right.Type() != INTERGER_OBJ {
+		return newError("bitwise operators not supported for type: %s", right.Type())
+	}
+	value := right.(*Integer).Value
+
+	return NewInteger(^value)
+}
+
+func integerInfixOperator(operator string, left, right Object) Object {
+	leftVal := left.(*Integer).Value
+	rightVal := right.(*Integer).Value
+
+	switch operator {
+	// Group 1: Produce values of other types than booleans
+	case "+":
+		return NewInteger(leftVal + rightVal)
+	case "-":
+		return NewInteger(leftVal - rightVal)
+	case "*":
+		return NewInteger(leftVal * rightVal)
+	case "/":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		return NewInteger(leftVal / rightVal)
+	case "%":
+		if rightVal == 0 {
+			return newError("modulo by zero")
+		}
+		return NewInteger(leftVal % rightVal)
+	case ">>":
+		if rightVal < 0 {
+			return newError("negative shift count: %d", rightVal)
+		}
+		return NewInteger(leftVal >> rightVal)
+	case "<<":
+		if rightVal < 0 {
+			return newError("negative shift count: %d", rightVal)
+		}
+		return NewInteger(leftVal << rightVal)
+	case "|":
+		return NewInteger(leftVal | rightVal)
+	case "&":
+		return NewInteger(leftVal & rightVal)
+	case "^":
+		return NewInteger(leftVal ^ rightVal)
+	// Group 2: Produce booleans as their results
+	case "<":
+		return NativeBool(leftVal < rightVal)
+	case ">":
+		return NativeBool(leftVal > rightVal)
+	case "<=":
+		return NativeBool(leftVal <= rightVal)
+	case ">=":
+		return NativeBool(leftVal >= rightVal)
+	case "==":
+		return NativeBool(leftVal == rightVal)
+	case "!=":
+		return NativeBool(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func floatInfixOperator(operator string, left, right Object) Object {
+	// Round up to 6th decimal place
+	leftVal := left.(*Float).Value
+	rightVal := right.(*Float).Value
+
+	switch operator {
+	case "+":
+		return &Float{Value: ToFixed(leftVal+rightVal, FloatPrecision)}
+	case "-":
+		return &Float{Value: leftVal - rightVal}
+	case "*":
+		return &Float{Value: leftVal * rightVal}
+	case "/":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		return &Float{Value: ToFixed(leftVal/rightVal, FloatPrecision)}
+	case "%":
+		if rightVal == 0 {
+			return newError("modulo by zero")
+		}
+		return &Float{Value: ToFixed(math.Mod(leftVal, rightVal), FloatPrecision)}
+	case "<":
+		return NativeBool(leftVal < rightVal)
+	case ">":
+		return NativeBool(leftVal > rightVal)
+	// Equal within FloatEpsilon counts as equal, just like ==
+	case "<=":
+		return NativeBool(leftVal < rightVal || math.Abs(leftVal-rightVal) < FloatEpsilon)
+	case ">=":
+		return NativeBool(leftVal > rightVal || math.Abs(leftVal-rightVal) < FloatEpsilon)
+	case "==":
+		return NativeBool(math.Abs(leftVal-rightVal) < FloatEpsilon)
+	case "!=":
+		return NativeBool(math.Abs(leftVal-rightVal) >= FloatEpsilon)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func stringInfixOperator(operator string, left, right Object) Object {
+	leftVal := left.(*String).Value
+	rightVal := right.(*String).Value
+
+	switch operator {
+	case "+":
+		return ConcatStrings(left.(*String), right.(*String))
+	// Strings are compared by value, not by identity like booleans
+	case "==":
+		return NativeBool(leftVal == rightVal)
+	case "!=":
+		return NativeBool(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// Tuples are values, so they are compared element by element
+func tupleInfixOperator(operator string, left, right Object) Object {
+	switch operator {
+	case "==":
+		return NativeBool(Equal(left, right))
+	case "!=":
+		return NativeBool(!Equal(left, right))
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// Report whether two values are equal the way == compares them, going into tuples element by element.
+// Both engines compare tuples with this. Values of different types are not equal, except for numbers
+func Equal(left, right Object) bool {
+	switch {
+	case left.Type() == INTERGER_OBJ && right.Type() == INTERGER_OBJ:
+		return left.(*Integer).Value == right.(*Integer).Value
+	case IsNumeric(left) && IsNumeric(right):
+		return math.Abs(ToFloat(left).Value-ToFloat(right).Value) < FloatEpsilon
+	case left.Type() == STRING_OBJ && right.Type() == STRING_OBJ:
+		return left.(*String).Value == right.(*String).Value
+	// The engines have booleans and null of their own, so compare them by value
+	case left.Type() == BOOLEAN_OBJ && right.Type() == BOOLEAN_OBJ:
+		return left.(*Boolean).Value == right.(*Boolean).Value
+	case left.Type() == NULL_OBJ && right.Type() == NULL_OBJ:
+		return true
+	case left.Type() == TUPLE_OBJ && right.Type() == TUPLE_OBJ:
+		leftElements := left.(*Tuple).Elements
+		rightElements := right.(*Tuple).Elements
+		if len(leftElements) != len(rightElements) {
+			return false
+		}
+		for i := range leftElements {
+			if !Equal(leftElements[i], rightElements[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return left == right
+	}
+}
@@ -14,8 +14,10 @@ const (
 	_ int = iota // Give the following constants incrementing numbers as value
 	LOWEST
 	ASSIGN
-	EQUALS      // ==
 	CONDITIONAL // ? and :
+	LOGICAL_OR  // ||
+	LOGICAL_AND // &&
+	EQUALS      // ==
 	LESSGREATER // > or <
 	BITWISE     // &, |, ^, ~, <<, >>
 	SUM         // +
@@ -23,7 +25,7 @@ const (
 	PREFIX      // -X or !X
 	POSTFIX     // x++ or x--
 	CALL        // myFunction(X)
-	INDEX       // arr[index]
+	INDEX       // arr[index] or point.x
 )
 
 // Precedence table - Map token types with their precedence
@@ -32,13 +34,18 @@ var precedences = map[token.TokenType]int{
 	token.NOT_EQ:    EQUALS,
 	token.LT:        LESSGREATER,
 	token.GT:        LESSGREATER,
+	token.LTE:       LESSGREATER,
+	token.GTE:       LESSGREATER,
 	token.PLUS:      SUM,
 	token.MINUS:     SUM,
 	token.SLASH:     PRODUCT,
 	token.ASTERISK:  PRODUCT,
+	token.MODULO:    PRODUCT,
 	token.LPAREN:    CALL,
 	token.QUESTION:  CONDITIONAL,
 	token.LBRACKET:  INDEX,
+	token.DOT:       INDEX,
+	token.LBRACE:    CALL,
 	token.TILDE:     BITWISE,
 	token.EXPONENT:  BITWISE,
 	token.PIPE:      BITWISE,
@@ -46,6 +53,21 @@ var precedences = map[token.TokenType]int{
 	token.RSHIFT:    BITWISE,
 	token.LSHIFT:    BITWISE,
 	token.ASSIGN:    ASSIGN,
+	token.OR:        LOGICAL_OR,
+	token.AND:       LOGICAL_AND,
+
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+}
+
+// Map compound assignment operators to the infix operator they apply
+var compoundOperators = map[token.TokenType]token.Token{
+	token.PLUS_ASSIGN:     {Type: token.PLUS, Literal: "+"},
+	token.MINUS_ASSIGN:    {Type: token.MINUS, Literal: "-"},
+	token.ASTERISK_ASSIGN: {Type: token.ASTERISK, Literal: "*"},
+	token.SLASH_ASSIGN:    {Type: token.SLASH, Literal: "/"},
 }
 
 type (
@@ -89,6 +111,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
@@ -112,18 +135,30 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LTE, p.parseInfixExpression)
+	p.registerInfix(token.GTE, p.parseInfixExpression)
+	p.registerInfix(token.MODULO, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.QUESTION, p.parseTernaryExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.DOT, p.parseFieldExpression)
+	// Conditions are always in parentheses, so a { after an expression can only start a struct literal
+	p.registerInfix(token.LBRACE, p.parseStructLiteral)
 	p.registerInfix(token.EXPONENT, p.parseInfixExpression)
 	p.registerInfix(token.PIPE, p.parseInfixExpression)
 	p.registerInfix(token.RSHIFT, p.parseInfixExpression)
 	p.registerInfix(token.LSHIFT, p.parseInfixExpression)
 	p.registerInfix(token.AMPERSAND, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
 	p.registerInfix(token.EXPONENT, p.parseInfixExpression)
 	// Assign binds two expressions e.g., a = b + c
 	// so it makes sense we make it an infix
 	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseCompoundAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseCompoundAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseCompoundAssignExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseCompoundAssignExpression)
 
 	p.postfixParseFns = make(map[token.TokenType]postfixParseFn)
 	precedences[token.INCREMENT] = POSTFIX
@@ -134,8 +169,14 @@ func New(l *lexer.Lexer) *Parser {
 	return p
 }
 
+// Return the errors from the lexer followed by the ones found while parsing
 func (p *Parser) Errors() []string {
-	return p.errors
+	if len(p.l.Errors()) == 0 {
+		return p.errors
+	}
+
+	errors := append([]string{}, p.l.Errors()...)
+	return append(errors, p.errors...)
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
@@ -169,11 +210,16 @@ func (p *Parser) registerPostfix(tokenType token.TokenType, fn postfixParseFn) {
 	HELPER METHODS
 */
 
-func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
+// Record an error prefixed with the position it was found at
+func (p *Parser) errorAt(pos token.Position, format string, a ...any) {
+	msg := fmt.Sprintf("%s: %s", pos, fmt.Sprintf(format, a...))
 	p.errors = append(p.errors, msg)
 }
 
+func (p *Parser) peekError(t token.TokenType) {
+	p.errorAt(p.peekToken.Pos, "expected next token to be %s, got %s instead", t, p.peekToken.Type)
+}
+
 // Advance both of our p.currentToken and p.peekToken
 func (p *Parser) nextToken() {
 	p.prevToken = p.currentToken
@@ -243,6 +289,8 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseBreakStatement()
 	case token.CONTINUE:
 		return p.parseContinueStatement()
+	case token.STRUCT:
+		return p.parseStructStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -252,12 +300,19 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	// Construct an *ast.LetStatement node
 	stmt := &ast.LetStatement{Token: p.currentToken}
 
-	if !p.expectPeek(token.IDENT) {
-		return nil
+	if p.peekTokenIs(token.LPAREN) || p.peekTokenIs(token.LBRACKET) || p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
+		stmt.Pattern = p.parsePattern()
+		if stmt.Pattern == nil {
+			return nil
+		}
+	} else {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Name = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
 	}
 
-	stmt.Name = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
-
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
 	}
@@ -267,7 +322,7 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	stmt.Value = p.parseExpression(LOWEST)
 
 	// Bind the variable name to the function
-	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok && stmt.Name != nil {
 		fl.Name = stmt.Name.Value
 	}
 
@@ -278,12 +333,128 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return stmt
 }
 
+func (p *Parser) parseStructStatement() *ast.StructStatement {
+	stmt := &ast.StructStatement{Token: p.currentToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Fields = []*ast.Identifier{}
+	seen := map[string]bool{}
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		field := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+		if seen[field.Value] {
+			p.errorAt(field.Pos(), "field %s declared twice in struct %s", field.Value, stmt.Name.Value)
+			return nil
+		}
+		seen[field.Value] = true
+		stmt.Fields = append(stmt.Fields, field)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// Parse the (q, r) of let (q, r) = ..., where the current token is the "("
+// Parse a pattern starting at the current token: (q, r), [a, b, ...rest] or {name, age}.
+// Returns nil on errors, which is not the same as a nil ast.Pattern
+func (p *Parser) parsePattern() ast.Pattern {
+	tok := p.currentToken
+
+	switch tok.Type {
+	case token.LPAREN:
+		names, _, ok := p.parsePatternNames(token.RPAREN, false)
+		if !ok {
+			return nil
+		}
+		return &ast.TuplePattern{Token: tok, Names: names}
+	case token.LBRACKET:
+		names, rest, ok := p.parsePatternNames(token.RBRACKET, true)
+		if !ok {
+			return nil
+		}
+		return &ast.ArrayPattern{Token: tok, Names: names, Rest: rest}
+	default:
+		names, _, ok := p.parsePatternNames(token.RBRACE, false)
+		if !ok {
+			return nil
+		}
+		return &ast.HashPattern{Token: tok, Names: names}
+	}
+}
+
+// Parse the comma separated names of a pattern up to the end token,
+// and a trailing ...rest if the pattern may have one
+func (p *Parser) parsePatternNames(end token.TokenType, allowRest bool) ([]*ast.Identifier, *ast.Identifier, bool) {
+	names := []*ast.Identifier{}
+	var rest *ast.Identifier
+
+	for !p.peekTokenIs(end) {
+		if rest != nil {
+			p.errorAt(p.peekToken.Pos, "...%s must be the last name in the pattern", rest.Value)
+			return nil, nil, false
+		}
+
+		if allowRest && p.peekTokenIs(token.ELLIPSIS) {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return nil, nil, false
+			}
+			rest = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+		} else {
+			if !p.expectPeek(token.IDENT) {
+				return nil, nil, false
+			}
+			names = append(names, &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal})
+		}
+
+		if !p.peekTokenIs(end) && !p.expectPeek(token.COMMA) {
+			return nil, nil, false
+		}
+	}
+	if !p.expectPeek(end) {
+		return nil, nil, false
+	}
+
+	return names, rest, true
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.currentToken}
 
 	p.nextToken()
 	stmt.ReturnValue = p.parseExpression(LOWEST)
 
+	// return a, b returns the tuple (a, b)
+	if p.peekTokenIs(token.COMMA) {
+		tuple := &ast.TupleLiteral{Token: stmt.Token, Elements: []ast.Expression{stmt.ReturnValue}}
+		for p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+			p.nextToken()
+			tuple.Elements = append(tuple.Elements, p.parseExpression(LOWEST))
+		}
+		stmt.ReturnValue = tuple
+	}
+
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -363,7 +534,8 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 			leftExp = infix(leftExp)
 			continue // Continue to handle other cases like using both pre/postfix with infix
 		} else {
-			if !p.currentTokenIs(token.IDENT) && !p.currentTokenIs(token.INT) && !p.currentTokenIs(token.FLOAT) {
+			// Variables, numbers and elements like arr[i]++
+			if !p.currentTokenIs(token.IDENT) && !p.currentTokenIs(token.INT) && !p.currentTokenIs(token.FLOAT) && !p.currentTokenIs(token.RBRACKET) {
 				return leftExp
 			}
 
@@ -382,13 +554,15 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	// The lexer already explains what is wrong with the token
+	if t == token.ILLEGAL {
+		return
+	}
+	p.errorAt(p.currentToken.Pos, "no prefix parse function for %s found", t)
 }
 
 func (p *Parser) noPostfixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no postfix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.errorAt(p.currentToken.Pos, "no postfix parse function for %s found", t)
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
@@ -401,8 +575,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 
 	value, err := strconv.ParseInt(p.currentToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.currentToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.errorAt(p.currentToken.Pos, "could not parse %q as integer", p.currentToken.Literal)
 		return nil
 	}
 
@@ -418,8 +591,7 @@ func (p *Parser) parseFloatLiteral() ast.Expression {
 	// Automatically round to 6 decimal places
 	value, err := strconv.ParseFloat(p.currentToken.Literal, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as float", p.currentToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.errorAt(p.currentToken.Pos, "could not parse %q as float", p.currentToken.Literal)
 		return nil
 	}
 
@@ -482,6 +654,21 @@ func (p *Parser) parseAssignExpression(left ast.Expression) ast.Expression {
 	return expr
 }
 
+// Compound assignments e.g., x += 1 are assignments carrying the operator,
+// so the engines evaluate the target only once, even for a[f()] += 1
+func (p *Parser) parseCompoundAssignExpression(left ast.Expression) ast.Expression {
+	expr := &ast.Assignment{
+		Token:    p.currentToken,
+		Name:     left,
+		Operator: compoundOperators[p.currentToken.Type].Literal,
+	}
+
+	p.nextToken()
+	expr.Value = p.parseExpression(LOWEST)
+
+	return expr
+}
+
 // At this point we already parsed the left expression
 // We thus need to consider parsing the precedence
 func (p *Parser) parsePostfixExpression(left ast.Expression) ast.Expression {
@@ -500,11 +687,24 @@ func (p *Parser) parseBoolean() ast.Expression {
 // Maintain proper precedence by treating the grouped expression as a single unit
 func (p *Parser) parseGroupedExpression() ast.Expression {
 	// When this function is called, currentToken is at '('
+	tok := p.currentToken
+
+	// () is the empty tuple
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return &ast.TupleLiteral{Token: tok, Elements: []ast.Expression{}}
+	}
+
 	p.nextToken()
 
 	// Parse everything until ')'
 	expr := p.parseExpression(LOWEST)
 
+	// A comma makes it a tuple
+	if p.peekTokenIs(token.COMMA) {
+		return p.parseTupleLiteral(tok, expr)
+	}
+
 	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
@@ -512,6 +712,27 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 	return expr
 }
 
+// Parse the rest of a tuple after its first element, where the peek token is the comma after it
+func (p *Parser) parseTupleLiteral(tok token.Token, first ast.Expression) ast.Expression {
+	tuple := &ast.TupleLiteral{Token: tok, Elements: []ast.Expression{first}}
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		// A trailing comma is allowed, (1,) even needs one
+		if p.peekTokenIs(token.RPAREN) {
+			break
+		}
+		p.nextToken()
+		tuple.Elements = append(tuple.Elements, p.parseExpression(LOWEST))
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	return tuple
+}
+
 func (p *Parser) parseIfExpression() ast.Expression {
 	expr := &ast.IfExpression{Token: p.currentToken}
 
@@ -549,6 +770,43 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expr
 }
 
+func (p *Parser) parseTryExpression() ast.Expression {
+	expr := &ast.TryExpression{Token: p.currentToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expr.Block = p.parseBlockStatement()
+
+	// The catch clause is mandatory, there is nothing else to do with an error
+	if !p.expectPeek(token.CATCH) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	expr.Param = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expr.Handler = p.parseBlockStatement()
+
+	return expr
+}
+
 func (p *Parser) parseWhileStatement() *ast.WhileStatement {
 	expr := &ast.WhileStatement{Token: p.currentToken}
 	if !p.expectPeek(token.LPAREN) {
@@ -631,7 +889,7 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
-	lit.Parameters = p.parseFunctionParameters()
+	lit.Parameters, lit.Defaults, lit.Rest, lit.Patterns = p.parseFunctionParameters()
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
@@ -642,34 +900,82 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	return lit
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
+// Parse parameters like (a, b = 2, ...rest): plain names first, then the ones with a default value,
+// and last a rest parameter collecting the arguments left over.
+// Any but the rest parameter can be a pattern like [a, b] instead of a name.
+// The defaults and the patterns are nil if no parameter has one
+func (p *Parser) parseFunctionParameters() ([]*ast.Identifier, []ast.Expression, *ast.Identifier, []ast.Pattern) {
 	idents := []*ast.Identifier{}
+	var defaults []ast.Expression
+	var rest *ast.Identifier
+	var patterns []ast.Pattern
+	hasDefaults, hasPatterns := false, false
 
 	// Case no param specified
 	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
-		return idents
+		return idents, nil, nil, nil
 	}
 
-	p.nextToken() // At this point our current token is the 1st param
+	for {
+		p.nextToken() // At this point our current token is the next param
 
-	ident := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
-	idents = append(idents, ident)
+		if rest != nil {
+			p.errorAt(p.currentToken.Pos, "rest parameter ...%s must be the last parameter", rest.Value)
+			return nil, nil, nil, nil
+		}
 
-	for p.peekTokenIs(token.COMMA) {
-		p.nextToken() // to the comma
-		p.nextToken() // to the next func param
+		if p.currentTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return nil, nil, nil, nil
+			}
+			rest = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+		} else {
+			ident := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+
+			var pattern ast.Pattern
+			if p.currentTokenIs(token.LPAREN) || p.currentTokenIs(token.LBRACKET) || p.currentTokenIs(token.LBRACE) {
+				pattern = p.parsePattern()
+				if pattern == nil {
+					return nil, nil, nil, nil
+				}
+				// No name can be written like a pattern, so the parameter can't clash with the ones bound by it
+				ident.Value = pattern.String()
+				hasPatterns = true
+			}
+			idents = append(idents, ident)
+			patterns = append(patterns, pattern)
+
+			var value ast.Expression
+			if p.peekTokenIs(token.ASSIGN) {
+				p.nextToken() // to the =
+				p.nextToken() // to the default value
+				value = p.parseExpression(LOWEST)
+				hasDefaults = true
+			} else if hasDefaults {
+				p.errorAt(ident.Token.Pos, "parameter %s needs a default value, it comes after one with a default", ident.Value)
+				return nil, nil, nil, nil
+			}
+			defaults = append(defaults, value)
+		}
 
-		// Parsing the remaining params
-		ident := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
-		idents = append(idents, ident)
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken() // to the comma
 	}
 
 	if !p.expectPeek(token.RPAREN) {
-		return nil
+		return nil, nil, nil, nil
 	}
 
-	return idents
+	if !hasDefaults {
+		defaults = nil
+	}
+	if !hasPatterns {
+		patterns = nil
+	}
+	return idents, defaults, rest, patterns
 }
 
 func (p *Parser) parseCallExpression(fn ast.Expression) ast.Expression {
@@ -725,19 +1031,18 @@ func (p *Parser) parseTernaryExpression(condition ast.Expression) ast.Expression
 		Condition: condition,
 	}
 
-	pre := p.currentPrecedence()
-
 	p.nextToken() // Move past the "?"
-	expr.Consequence = p.parseExpression(pre)
+	// The consequence is delimited by the ":", so it can be any expression, even another ternary
+	expr.Consequence = p.parseExpression(LOWEST)
 
 	if !p.expectPeek(token.COLON) {
-		msg := fmt.Sprintf("expected next token to be %s", p.peekToken.Type)
-		p.errors = append(p.errors, msg)
+		p.errorAt(p.peekToken.Pos, "expected next token to be %s", p.peekToken.Type)
 		return nil
 	}
 
 	p.nextToken() // Move past the ":"
-	expr.Alternative = p.parseExpression(pre)
+	// Right associative, a ? b : c ? d : e is a ? b : (c ? d : e)
+	expr.Alternative = p.parseExpression(CONDITIONAL - 1)
 
 	return expr
 }
@@ -756,6 +1061,64 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	return expr
 }
 
+func (p *Parser) parseFieldExpression(left ast.Expression) ast.Expression {
+	expr := &ast.FieldExpression{Token: p.currentToken, Object: left}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	expr.Field = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+
+	return expr
+}
+
+// Parse Point { x: 1, y: 2 }, where the current token is the "{".
+// Fields left out are null
+func (p *Parser) parseStructLiteral(left ast.Expression) ast.Expression {
+	lit := &ast.StructLiteral{Token: p.currentToken, Type: left}
+
+	if left == nil {
+		// The error is already recorded
+		return nil
+	}
+	if _, ok := left.(*ast.Identifier); !ok {
+		p.errorAt(lit.Token.Pos, "struct literal needs the name of a struct type, got %s", left.String())
+		return nil
+	}
+
+	lit.Fields = []*ast.Identifier{}
+	lit.Values = []ast.Expression{}
+	seen := map[string]bool{}
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		field := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+		if seen[field.Value] {
+			p.errorAt(field.Pos(), "field %s given twice", field.Value)
+			return nil
+		}
+		seen[field.Value] = true
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+		p.nextToken()
+
+		lit.Fields = append(lit.Fields, field)
+		lit.Values = append(lit.Values, p.parseExpression(LOWEST))
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return lit
+}
+
 func (p *Parser) parseHashLiteral() ast.Expression {
 	hash := &ast.HashLiteral{Token: p.currentToken}
 	hash.Pairs = make(map[ast.Expression]ast.Expression)
@@ -791,7 +1154,18 @@ func (p *Parser) parseMacroLiteral() ast.Expression {
 		return nil
 	}
 
-	lit.Parameters = p.parseFunctionParameters()
+	var defaults []ast.Expression
+	var rest *ast.Identifier
+	var patterns []ast.Pattern
+	lit.Parameters, defaults, rest, patterns = p.parseFunctionParameters()
+	if defaults != nil || rest != nil {
+		p.errorAt(lit.Token.Pos, "macros take no default or rest parameters")
+		return nil
+	}
+	if patterns != nil {
+		p.errorAt(lit.Token.Pos, "macros take no pattern parameters")
+		return nil
+	}
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
@@ -481,6 +481,26 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"5 & 3 ? 1 : 2",
 			"((5 & 3) ? 1 : 2)",
 		},
+		{
+			"a == b ? c : d",
+			"((a == b) ? c : d)",
+		},
+		{
+			"a != b ? c == d : e != f",
+			"((a != b) ? (c == d) : (e != f))",
+		},
+		{
+			"a ? b ? c : d : e",
+			"(a ? (b ? c : d) : e)",
+		},
+		{
+			"a ? b : c ? d : e",
+			"(a ? b : (c ? d : e))",
+		},
+		{
+			"x = a ? b : c",
+			"(x = (a ? b : c))",
+		},
 		{
 			"a * [1, 2, 3, 4][b * c] * d",
 			"((a * ([1, 2, 3, 4][(b * c)])) * d)",
@@ -513,6 +533,18 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"a - b--",
 			"(a - (b--))",
 		},
+		{
+			"a[0]++ + 1",
+			"(((a[0])++) + 1)",
+		},
+		{
+			"p.x-- * 2",
+			"(((p.x)--) * 2)",
+		},
+		{
+			"++a[0]",
+			"(++(a[0]))",
+		},
 		// {
 		// 	// This is wrong by default of many lannguages
 		// 	"(a++)++",
@@ -538,6 +570,50 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a++, b--)",
 			"add((a++), (b--))",
 		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a <= b == b >= a",
+			"((a <= b) == (b >= a))",
+		},
+		{
+			"a + b % c * d",
+			"(a + ((b % c) * d))",
+		},
+		{
+			"a % b <= c && c >= d",
+			"(((a % b) <= c) && (c >= d))",
+		},
+		{
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"a || b ? c : d",
+			"((a || b) ? c : d)",
+		},
+		{
+			"a && b ? c || d : e && f",
+			"((a && b) ? (c || d) : (e && f))",
+		},
+		{
+			"a > 0 && b ? c : d",
+			"(((a > 0) && b) ? c : d)",
+		},
+		{
+			"a > 0 && b != 1",
+			"((a > 0) && (b != 1))",
+		},
+		{
+			"!a || a & b",
+			"((!a) || (a & b))",
+		},
+		{
+			"x = a || b",
+			"(x = (a || b))",
+		},
 	}
 	for _, tt := range tests {
 		l := lexer.New(tt.input)
@@ -552,6 +628,177 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 	}
 }
 
+func TestFieldExpressionPrecedence(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"p.x", "(p.x)"},
+		{"a.b.c", "((a.b).c)"},
+		{"-p.x", "(-(p.x))"},
+		{"p.x * q.y", "((p.x) * (q.y))"},
+		{"f(p).x", "(f(p).x)"},
+		{"arr[0].x", "((arr[0]).x)"},
+		{"p.items[1]", "((p.items)[1])"},
+		{"Point { x: 1 }.x", "(Point { x: 1 }.x)"},
+		{"1 + Point { x: 1 + 2 }", "(1 + Point { x: (1 + 2) })"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestStructStatementParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedName   string
+		expectedFields []string
+	}{
+		{"struct Point { x, y }", "Point", []string{"x", "y"}},
+		{"struct Empty {};", "Empty", []string{}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got: %d", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.StructStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.StructStatement. got: %T", program.Statements[0])
+		}
+
+		if stmt.Name.Value != tt.expectedName {
+			t.Errorf("stmt.Name.Value not %q. got: %q", tt.expectedName, stmt.Name.Value)
+		}
+
+		if len(stmt.Fields) != len(tt.expectedFields) {
+			t.Fatalf("length fields wrong. want: %d, got: %d", len(tt.expectedFields), len(stmt.Fields))
+		}
+		for i, field := range tt.expectedFields {
+			testIdentifier(t, stmt.Fields[i], field)
+		}
+	}
+}
+
+func TestStructLiteralParsing(t *testing.T) {
+	input := `Point { x: 1, y: 2 * 3 }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	lit, ok := stmt.Expression.(*ast.StructLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.StructLiteral. got: %T", stmt.Expression)
+	}
+
+	testIdentifier(t, lit.Type, "Point")
+
+	if len(lit.Fields) != 2 || len(lit.Values) != 2 {
+		t.Fatalf("lit has wrong number of fields. got: %d fields, %d values", len(lit.Fields), len(lit.Values))
+	}
+	testIdentifier(t, lit.Fields[0], "x")
+	testIntegerLiteral(t, lit.Values[0], 1)
+	testIdentifier(t, lit.Fields[1], "y")
+	testInfixExpression(t, lit.Values[1], 2, 3, "*")
+}
+
+func TestTupleParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(1, a + 2, true)", "(1, (a + 2), true)"},
+		{"(1,)", "(1,)"},
+		{"(1, 2,)", "(1, 2)"},
+		{"()", "()"},
+		// Without a comma the parentheses only group
+		{"(1)", "1"},
+		{"{(1, 2): 3}[(1, 2)]", "({(1, 2):3}[(1, 2)])"},
+		{"let (q, r) = divmod(7, 2);", "let (q, r) = divmod(7, 2);"},
+		{"return a, b + 1;", "return (a, (b + 1));"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestPatternParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, b, ...rest] = arr;", "let [a, b, ...rest] = arr;"},
+		{"let [...all] = arr;", "let [...all] = arr;"},
+		{"let [] = arr;", "let [] = arr;"},
+		{"let {name, age} = person;", "let {name, age} = person;"},
+		{"let {name,} = person;", "let {name} = person;"},
+		{"funk([a, b], {name}, (q, r), c = 1) { a }", "funk([a, b], {name}, (q, r), c = 1) a"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+
+	l := lexer.New("funk(a, [b, ...c]) { b }")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if len(fn.Parameters) != 2 || len(fn.Patterns) != 2 {
+		t.Fatalf("wrong number of parameters/patterns. got=%d/%d", len(fn.Parameters), len(fn.Patterns))
+	}
+	if fn.Patterns[0] != nil {
+		t.Errorf("plain parameter has a pattern. got=%s", fn.Patterns[0])
+	}
+	pattern, ok := fn.Patterns[1].(*ast.ArrayPattern)
+	if !ok {
+		t.Fatalf("pattern is not ast.ArrayPattern. got=%T", fn.Patterns[1])
+	}
+	if len(pattern.Names) != 1 || pattern.Names[0].Value != "b" || pattern.Rest.Value != "c" {
+		t.Errorf("wrong pattern. got=%s", pattern)
+	}
+	// The parameter is named after its pattern
+	if fn.Parameters[1].Value != "[b, ...c]" {
+		t.Errorf("wrong parameter name. got=%q", fn.Parameters[1].Value)
+	}
+}
+
 func TestBooleanExpression(t *testing.T) {
 	input := "true;"
 
@@ -780,6 +1027,85 @@ func TestFunctionParametersParsing(t *testing.T) {
 	}
 }
 
+func TestDefaultAndRestParametersParsing(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedParams   []string
+		expectedDefaults []string
+		expectedRest     string
+		expectedString   string
+	}{
+		{
+			input:            "funk(a, b = 2) {};",
+			expectedParams:   []string{"a", "b"},
+			expectedDefaults: []string{"", "2"},
+			expectedString:   "funk(a, b = 2) ",
+		},
+		{
+			input:            "funk(a = 1, b = a * 2) {};",
+			expectedParams:   []string{"a", "b"},
+			expectedDefaults: []string{"1", "(a * 2)"},
+			expectedString:   "funk(a = 1, b = (a * 2)) ",
+		},
+		{
+			input:          "funk(...rest) {};",
+			expectedParams: []string{},
+			expectedRest:   "rest",
+			expectedString: "funk(...rest) ",
+		},
+		{
+			input:            "funk(a, b = 2, ...rest) {};",
+			expectedParams:   []string{"a", "b"},
+			expectedDefaults: []string{"", "2"},
+			expectedRest:     "rest",
+			expectedString:   "funk(a, b = 2, ...rest) ",
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		fn := stmt.Expression.(*ast.FunctionLiteral)
+
+		if len(fn.Parameters) != len(tt.expectedParams) {
+			t.Fatalf("length parameters wrong. want: %d, got: %d\n", len(tt.expectedParams), len(fn.Parameters))
+		}
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, fn.Parameters[i], ident)
+		}
+
+		if len(fn.Defaults) != len(tt.expectedDefaults) {
+			t.Fatalf("length defaults wrong. want: %d, got: %d\n", len(tt.expectedDefaults), len(fn.Defaults))
+		}
+		for i, expected := range tt.expectedDefaults {
+			got := ""
+			if fn.Defaults[i] != nil {
+				got = fn.Defaults[i].String()
+			}
+			if got != expected {
+				t.Errorf("default %d wrong. want: %q, got: %q", i, expected, got)
+			}
+		}
+
+		rest := ""
+		if fn.Rest != nil {
+			rest = fn.Rest.Value
+		}
+		if rest != tt.expectedRest {
+			t.Errorf("rest parameter wrong. want: %q, got: %q", tt.expectedRest, rest)
+		}
+
+		if fn.String() != tt.expectedString {
+			t.Errorf("fn.String() wrong. want: %q, got: %q", tt.expectedString, fn.String())
+		}
+	}
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	input := `add(1, 2 * 3, 4 + 5)`
 	l := lexer.New(input)
@@ -1368,6 +1694,37 @@ func TestAssignmentExpressionPrecedence(t *testing.T) {
 
 		// Assignment with function calls
 		{"result = func(x);", "(result = func(x))"},
+
+		// Assignment to a field
+		{"p.x = 5;", "((p.x) = 5)"},
+		{"p.x = q.y = 1;", "((p.x) = ((q.y) = 1))"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestCompoundAssignmentParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// Compound assignments are desugared to plain assignments
+		{"x += 1;", "(x += 1)"},
+		{"x -= 2 * 3;", "(x -= (2 * 3))"},
+		{"x *= y + 1;", "(x *= (y + 1))"},
+		{"x /= 2;", "(x /= 2)"},
+		{"arr[0] += 1;", "((arr[0]) += 1)"},
+		{"x = y += 1;", "(x = (y += 1))"},
 	}
 
 	for _, tt := range tests {
@@ -1546,3 +1903,136 @@ func testAssignmentExpression(t *testing.T, expr ast.Expression, left string, ri
 
 	return true
 }
+
+func TestTryExpressionParsing(t *testing.T) {
+	input := `try { x / y } catch (err) { err }`
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements has not enough statements. got: %d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got: %T", program.Statements[0])
+	}
+
+	expr, ok := stmt.Expression.(*ast.TryExpression)
+	if !ok {
+		t.Fatalf("expr not ast.TryExpression. got: %T", stmt.Expression)
+	}
+
+	if len(expr.Block.Statements) != 1 {
+		t.Fatalf("block is not 1 statement. got: %d", len(expr.Block.Statements))
+	}
+
+	block, ok := expr.Block.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Block.Statements[0] not ast.ExpressionStatement. got: %T", expr.Block.Statements[0])
+	}
+
+	if !testInfixExpression(t, block.Expression, "x", "y", "/") {
+		return
+	}
+
+	if !testLiteralExpression(t, expr.Param, "err") {
+		return
+	}
+
+	if len(expr.Handler.Statements) != 1 {
+		t.Fatalf("handler is not 1 statement. got: %d", len(expr.Handler.Statements))
+	}
+
+	handler, ok := expr.Handler.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Handler.Statements[0] not ast.ExpressionStatement. got: %T", expr.Handler.Statements[0])
+	}
+
+	if !testIdentifier(t, handler.Expression, "err") {
+		return
+	}
+
+	if program.String() != "try (x / y)catch(err) err" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+}
+
+func TestParserErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x 5;", "test.s8:1:7: expected next token to be =, got INT instead"},
+		{"let x = 1;\n  let = 2;", "test.s8:2:7: expected next token to be IDENT, got = instead"},
+		{"1 +\n\n;", "test.s8:3:1: no prefix parse function for ; found"},
+		{"try { 1 } 2", "test.s8:1:11: expected next token to be CATCH, got INT instead"},
+		{"funk(...a, b) {}", "test.s8:1:12: rest parameter ...a must be the last parameter"},
+		{"funk(a = 1, b) {}", "test.s8:1:13: parameter b needs a default value, it comes after one with a default"},
+		{"macro(a = 1) {}", "test.s8:1:1: macros take no default or rest parameters"},
+		{"struct P { x, x }", "test.s8:1:15: field x declared twice in struct P"},
+		{"P { x: 1, x: 2 }", "test.s8:1:11: field x given twice"},
+		{"f() { x: 1 }", "test.s8:1:5: struct literal needs the name of a struct type, got f()"},
+		{"let (a, 1) = x;", "test.s8:1:9: expected next token to be IDENT, got INT instead"},
+		{"let [...r, a] = x;", "test.s8:1:12: ...r must be the last name in the pattern"},
+		{"let (...r) = x;", "test.s8:1:6: expected next token to be IDENT, got ... instead"},
+		{"macro([a]) {}", "test.s8:1:1: macros take no pattern parameters"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewWithFilename(tt.input, "test.s8")
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q but got none", tt.input)
+		}
+
+		if errors[0] != tt.expected {
+			t.Errorf("wrong parser error. want=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
+func TestParsingWithComments(t *testing.T) {
+	input := `// Variable binding
+let age = 1; // one
+/* Bind functions
+   to names */
+let add = funk(a, b) { return a + b; /* explicit */ };`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	expected := "let age = 1;let add = funk<add>(a, b) return (a + b);;"
+	if program.String() != expected {
+		t.Errorf("wrong program. expected=%q, got=%q", expected, program.String())
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1; /* oops", "1:12: unterminated block comment"},
+		{"let x = @;", "1:9: illegal character \"@\""},
+	}
+
+	for _, tt := range errorTests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("expected exactly 1 error for %q. got=%q", tt.input, errors)
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
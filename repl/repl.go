@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"s8/compiler"
+	"s8/evaluator"
 	"s8/lexer"
 	"s8/object"
 	"s8/parser"
@@ -27,7 +28,8 @@ func Start(in io.Reader, out io.Writer) {
 
 	// env persists between calls to Eval()
 	// env := object.NewEnvironment()
-	// macroEnv := object.NewEnvironment()
+	// Macro definitions persist between lines just like the symbol table
+	macroEnv := object.NewEnvironment()
 
 	for {
 		fmt.Fprintf(out, PROMPT)
@@ -46,8 +48,13 @@ func Start(in io.Reader, out io.Writer) {
 			continue
 		}
 
-		// evaluator.DefineMacros(program, macroEnv)
-		// expanded := evaluator.ExpandMacros(program, macroEnv)
+		// Expand macros before compiling, since the VM knows nothing about them
+		expanded, err := evaluator.ExpandProgram(program, macroEnv)
+		if err != nil {
+			// The error already says that macro expansion failed
+			fmt.Fprintf(out, "%s\n", err)
+			continue
+		}
 
 		// evaluated := evaluator.Eval(expanded, env)
 
@@ -62,7 +69,7 @@ func Start(in io.Reader, out io.Writer) {
 		// comp := compiler.New()
 		// Preserve symbol table, constant pool and global store
 		comp := compiler.NewWithState(symbolTable, constants)
-		err := comp.Compile(program)
+		err = comp.Compile(expanded)
 		if err != nil {
 			fmt.Fprintf(out, "compilation failed:\n %s\n", err)
 			continue
@@ -81,10 +88,17 @@ func Start(in io.Reader, out io.Writer) {
 			continue
 		}
 
+		// Nothing ran for lines that only define macros or hold comments
+		if len(expanded.Statements) == 0 {
+			continue
+		}
+
 		stackTop := machine.LastPoppedStackElement()
+		if stackTop == nil {
+			continue
+		}
 		io.WriteString(out, stackTop.Inspect())
 		io.WriteString(out, "\n")
-
 	}
 }
 
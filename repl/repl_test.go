@@ -0,0 +1,32 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStart(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2", ">> 3\n>> "},
+		// Lines that leave nothing to print
+		{"let m = macro(a) { quote(unquote(a) * 2) };", ">> >> "},
+		{"// just a comment", ">> >> "},
+		{"/* block */", ">> >> "},
+		// Macros defined on one line can be used on the next
+		{"let m = macro(a) { quote(unquote(a) * 2) };\nm(21)", ">> >> 42\n>> "},
+		{"let m = macro() { 1 };\nm()", ">> >> macro expansion failed: we only support returning AST-nodes from macros\n>> "},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Start(strings.NewReader(tt.input), &out)
+
+		if out.String() != tt.expected {
+			t.Errorf("wrong output for %q. want=%q, got=%q", tt.input, tt.expected, out.String())
+		}
+	}
+}
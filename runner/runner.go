@@ -0,0 +1,153 @@
+package runner
+
+import (
+	"fmt"
+	"strings"
+
+	"s8/ast"
+	"s8/compiler"
+	"s8/evaluator"
+	"s8/lexer"
+	"s8/object"
+	"s8/parser"
+	"s8/vm"
+)
+
+const (
+	EngineVM   = "vm"
+	EngineEval = "eval"
+)
+
+// The stage of the pipeline a script failed in
+type Stage string
+
+const (
+	ParseStage   Stage = "parse"
+	CompileStage Stage = "compile"
+	RuntimeStage Stage = "runtime"
+)
+
+// An error from running a whole script, tagged with where it happened
+type Error struct {
+	Stage    Stage
+	Messages []string
+}
+
+func (e *Error) Error() string {
+	var out strings.Builder
+
+	out.WriteString(string(e.Stage) + " error")
+	if len(e.Messages) == 1 {
+		out.WriteString(": " + e.Messages[0])
+		return out.String()
+	}
+
+	out.WriteString("s:")
+	for _, msg := range e.Messages {
+		out.WriteString("\n\t" + msg)
+	}
+
+	return out.String()
+}
+
+// Lex, parse and execute a whole program with the given engine.
+// Unlike the REPL, the input is parsed in one go so multi-line functions work,
+// and the value of the last expression is returned instead of printed.
+// The file name only shows up in the positions of error messages
+func Run(filename string, input string, engine string) (object.Object, error) {
+	if engine != EngineVM && engine != EngineEval {
+		return nil, fmt.Errorf("unknown engine %q, use %q or %q", engine, EngineVM, EngineEval)
+	}
+
+	program, err := Parse(filename, input)
+	if err != nil {
+		return nil, err
+	}
+
+	if engine == EngineEval {
+		return runEval(program)
+	}
+
+	return runVM(program)
+}
+
+// Parse the input and expand its macros, so the program is ready for either engine
+func Parse(filename string, input string) (*ast.Program, error) {
+	l := lexer.NewWithFilename(input, filename)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &Error{Stage: ParseStage, Messages: p.Errors()}
+	}
+
+	expanded, err := evaluator.ExpandProgram(program, object.NewEnvironment())
+	if err != nil {
+		return nil, &Error{Stage: CompileStage, Messages: []string{err.Error()}}
+	}
+
+	return expanded, nil
+}
+
+// Compile a whole program to bytecode for the VM,
+// e.g. to save it to a .s8c file and run it later with RunBytecode.
+// See compiler.Compiler.Optimize for what optimize does
+func Compile(filename string, input string, optimize bool) (*compiler.Bytecode, error) {
+	program, err := Parse(filename, input)
+	if err != nil {
+		return nil, err
+	}
+
+	return compile(program, optimize)
+}
+
+// Execute compiled bytecode on the VM
+func RunBytecode(bytecode *compiler.Bytecode) (object.Object, error) {
+	machine := vm.New(bytecode)
+	err := machine.Run()
+	if err != nil {
+		msg := err.Error()
+		if runtimeErr, ok := err.(*vm.RuntimeError); ok {
+			msg += "\n" + runtimeErr.StackTrace()
+		}
+		return nil, &Error{Stage: RuntimeStage, Messages: []string{msg}}
+	}
+
+	return machine.LastPoppedStackElement(), nil
+}
+
+func compile(program *ast.Program, optimize bool) (*compiler.Bytecode, error) {
+	comp := compiler.New()
+	comp.Optimize = optimize
+	err := comp.Compile(program)
+	if err != nil {
+		return nil, &Error{Stage: CompileStage, Messages: []string{err.Error()}}
+	}
+
+	return comp.Bytecode(), nil
+}
+
+func runVM(program *ast.Program) (object.Object, error) {
+	bytecode, err := compile(program, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return RunBytecode(bytecode)
+}
+
+func runEval(program *ast.Program) (object.Object, error) {
+	env := object.NewEnvironment()
+
+	result := evaluator.Eval(program, env)
+	if errObj, ok := result.(*object.Error); ok {
+		// Same format as the VM's runtime errors
+		msg := errObj.Message
+		if errObj.Pos.IsValid() {
+			msg = errObj.Pos.String() + ": " + msg
+		}
+		return nil, &Error{Stage: RuntimeStage, Messages: []string{msg}}
+	}
+
+	return result, nil
+}
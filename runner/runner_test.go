@@ -0,0 +1,147 @@
+package runner
+
+import (
+	"bytes"
+	"s8/compiler"
+	"s8/object"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	// Multi-line input is the point: the REPL can only take one line at a time
+	input := `
+let fib = funk(x) {
+	if (x < 2) {
+		x
+	} else {
+		fib(x - 1) + fib(x - 2)
+	}
+};
+
+let unless = macro(cond, cons, alt) {
+	quote(if (!(unquote(cond))) { unquote(cons) } else { unquote(alt) });
+};
+
+unless(false, fib(10), 0);
+`
+
+	for _, engine := range []string{EngineVM, EngineEval} {
+		result, err := Run("test.s8", input, engine)
+		if err != nil {
+			t.Fatalf("engine=%s: unexpected error: %s", engine, err)
+		}
+
+		integer, ok := result.(*object.Integer)
+		if !ok {
+			t.Fatalf("engine=%s: object is not Integer. got=%T (%+v)", engine, result, result)
+		}
+		if integer.Value != 55 {
+			t.Errorf("engine=%s: wrong value. want=55, got=%d", engine, integer.Value)
+		}
+	}
+}
+
+func TestRunSavedBytecode(t *testing.T) {
+	input := `
+let greet = funk(name) { "hello " + name };
+greet("s8")
+`
+
+	bytecode, err := Compile("test.s8", input, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var buf bytes.Buffer
+	err = bytecode.Encode(&buf)
+	if err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+	loaded, err := compiler.Decode(&buf)
+	if err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+
+	result, err := RunBytecode(loaded)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	str, ok := result.(*object.String)
+	if !ok || str.Value != "hello s8" {
+		t.Errorf("wrong result. want=%q, got=%+v", "hello s8", result)
+	}
+
+	// Runtime errors still point at the source the bytecode was compiled from
+	bytecode, err = Compile("test.s8", "let x = 0;\n10 / x;", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	buf.Reset()
+	err = bytecode.Encode(&buf)
+	if err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+	loaded, err = compiler.Decode(&buf)
+	if err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+
+	_, err = RunBytecode(loaded)
+	if err == nil || !strings.Contains(err.Error(), "test.s8:2:4: division by zero") {
+		t.Errorf("wrong runtime error. got=%v", err)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		engine        string
+		expectedStage Stage
+	}{
+		{"let x = ;", EngineVM, ParseStage},
+		{"let x = ;", EngineEval, ParseStage},
+		{"y;", EngineVM, CompileStage},
+		{"y;", EngineEval, RuntimeStage},
+		{`1 + "a";`, EngineVM, RuntimeStage},
+		{`1 + "a";`, EngineEval, RuntimeStage},
+		{"break;", EngineVM, CompileStage},
+		{"1 / 0;", EngineVM, RuntimeStage},
+		{"1 / 0;", EngineEval, RuntimeStage},
+	}
+
+	for _, tt := range tests {
+		_, err := Run("test.s8", tt.input, tt.engine)
+		if err == nil {
+			t.Errorf("engine=%s, input=%q: expected error but resulted in none", tt.engine, tt.input)
+			continue
+		}
+
+		runErr, ok := err.(*Error)
+		if !ok {
+			t.Errorf("engine=%s, input=%q: error is not *Error. got=%T (%s)", tt.engine, tt.input, err, err)
+			continue
+		}
+
+		if runErr.Stage != tt.expectedStage {
+			t.Errorf("engine=%s, input=%q: wrong stage. want=%s, got=%s (%s)",
+				tt.engine, tt.input, tt.expectedStage, runErr.Stage, runErr)
+		}
+
+		if !strings.Contains(runErr.Error(), "test.s8:1:") {
+			t.Errorf("engine=%s, input=%q: error is missing its location. got=%q",
+				tt.engine, tt.input, runErr)
+		}
+	}
+
+	_, err := Run("test.s8", "let f = funk() { 1 / 0 }; f();", EngineVM)
+	if err == nil || !strings.Contains(err.Error(), "stack trace:\n\tat f (test.s8:1:20)\n\tat <main> (test.s8:1:28)") {
+		t.Errorf("VM runtime error is missing its stack trace. got=%q", err)
+	}
+
+	_, err = Run("test.s8", "1", "jit")
+	if err == nil {
+		t.Errorf("expected error for unknown engine but resulted in none")
+	}
+}
@@ -1,10 +1,34 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
-	Literal string // hold the literal value
+	Literal string   // hold the literal value
+	Pos     Position // where the token starts in the source
+}
+
+// A location in the source code. Lines and columns start at 1,
+// and the zero value means the position is unknown (e.g., nodes generated by macros)
+type Position struct {
+	Filename string
+	Line     int
+	Column   int
+}
+
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+// Format the position as file:line:col, or line:col if there is no file name
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	if p.Filename == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
 }
 
 var keywords = map[string]TokenType{
@@ -20,11 +44,16 @@ var keywords = map[string]TokenType{
 	"while":    WHILE,
 	"break":    BREAK,
 	"continue": CONTINUE,
+	"try":      TRY,
+	"catch":    CATCH,
+	"struct":   STRUCT,
 }
 
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
+	// Trivia: not passed to the parser, but kept around for tools like formatters
+	COMMENT = "COMMENT"
 
 	// Identifiers + literals
 	IDENT = "IDENT"
@@ -40,6 +69,9 @@ const (
 	SLASH     = "/"
 	LT        = "<"
 	GT        = ">"
+	LTE       = "<="
+	GTE       = ">="
+	MODULO    = "%"
 	EQ        = "=="
 	NOT_EQ    = "!="
 	INCREMENT = "++"
@@ -51,12 +83,21 @@ const (
 	RSHIFT    = ">>" // divided by 2 e.g., n >> x means n divided by 2, x times
 	LSHIFT    = "<<" // times 2 e.g., n << x means n times 2, x times
 	AMPERSAND = "&"
-	// TODO: Implement GTE (>=) and LTE (<=)
+	AND       = "&&" // logical AND, short-circuits
+	OR        = "||" // logical OR, short-circuits
+
+	// Compound assignment
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
 
 	// Delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
 	COLON     = ":"
+	ELLIPSIS  = "..." // rest parameters, e.g. funk(a, ...rest)
+	DOT       = "."   // field access, e.g. point.x
 
 	LPAREN = "("
 	RPAREN = ")"
@@ -75,6 +116,9 @@ const (
 	WHILE    = "WHILE"
 	BREAK    = "BREAK"
 	CONTINUE = "CONTINUE"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	STRUCT   = "STRUCT"
 
 	// Data types
 	STRING = "STRING"
@@ -0,0 +1,63 @@
+package vm
+
+import (
+	"strconv"
+	"strings"
+
+	"s8/token"
+)
+
+// An error raised while executing bytecode
+type RuntimeError struct {
+	Message string
+	// Where the failing instruction was compiled from, if known
+	Pos token.Position
+	// The call stack at the time of the error, innermost call first
+	Trace []TraceEntry
+}
+
+// A single call in the stack trace of a runtime error
+type TraceEntry struct {
+	Function string
+	Pos      token.Position
+}
+
+func (e *RuntimeError) Error() string {
+	if !e.Pos.IsValid() {
+		return e.Message
+	}
+	return e.Pos.String() + ": " + e.Message
+}
+
+// The most lines StackTrace shows, so deep recursion does not flood the output
+const maxStackTraceLines = 50
+
+// Format the call stack, one call per line. Runs of the same call, as left by
+// recursion, collapse into a single line, and the rest is cut off after maxStackTraceLines
+func (e *RuntimeError) StackTrace() string {
+	var out strings.Builder
+
+	out.WriteString("stack trace:")
+	lines := 0
+	for i := 0; i < len(e.Trace); {
+		if lines == maxStackTraceLines {
+			out.WriteString("\n\t... " + strconv.Itoa(len(e.Trace)-i) + " more calls")
+			break
+		}
+
+		entry := e.Trace[i]
+		repeated := 1
+		for i+repeated < len(e.Trace) && e.Trace[i+repeated] == entry {
+			repeated++
+		}
+
+		out.WriteString("\n\tat " + entry.Function + " (" + entry.Pos.String() + ")")
+		if repeated > 1 {
+			out.WriteString("\n\t... repeated " + strconv.Itoa(repeated-1) + " more times")
+		}
+		lines++
+		i += repeated
+	}
+
+	return out.String()
+}
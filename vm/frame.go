@@ -3,6 +3,7 @@ package vm
 import (
 	"s8/code"
 	"s8/object"
+	"s8/token"
 )
 
 type Frame struct {
@@ -14,6 +15,9 @@ type Frame struct {
 	// when we are done executing the function call.
 	// aka the frame pointer (Yes it's thing. Look up if you forget.)
 	basePointer int
+	// How many parameters the call passed arguments for,
+	// the others are computed from their default values
+	numArgs int
 }
 
 func NewFrame(cl *object.Closure, basePointer int) *Frame {
@@ -24,3 +28,16 @@ func NewFrame(cl *object.Closure, basePointer int) *Frame {
 func (f *Frame) Instructions() code.Instructions {
 	return f.cl.Fn.Instructions
 }
+
+// Return the source position of the instruction the frame is executing
+func (f *Frame) Position() token.Position {
+	return f.cl.Fn.SourceMap.Lookup(f.ip)
+}
+
+// Return the name of the function a frame is executing, for stack traces
+func (f *Frame) Name() string {
+	if f.cl.Fn.Name == "" {
+		return "<anonymous>"
+	}
+	return f.cl.Fn.Name
+}
@@ -2,6 +2,7 @@ package vm
 
 import (
 	"fmt"
+	"math"
 
 	"s8/code"
 	"s8/compiler"
@@ -18,6 +19,9 @@ const (
 	MaxFrames  = 1024
 )
 
+// How the main program shows up in stack traces
+const mainFunctionName = "<main>"
+
 var (
 	True  = &object.Boolean{Value: true}
 	False = &object.Boolean{Value: false}
@@ -34,12 +38,28 @@ type VM struct {
 	globals     []object.Object
 	frames      []*Frame
 	framesIndex int
+	// Error handlers installed by try blocks, innermost last
+	handlers []handler
+}
+
+// Where to resume when a try block raises an error
+type handler struct {
+	// The frame the try block runs in
+	framesIndex int
+	// The stack pointer when the try block started
+	sp int
+	// Position of the catch block in the frame's instructions
+	catchPos int
 }
 
 func New(bytecode *compiler.Bytecode) *VM {
 	// Pre-allocate the frames slice with the main frame,
 	// now we don't need to initialize the instructions in the VM struct.
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		SourceMap:    bytecode.SourceMap,
+		Name:         mainFunctionName,
+	}
 	mainClosure := &object.Closure{Fn: mainFn}
 	mainFrame := NewFrame(mainClosure, 0)
 
@@ -67,20 +87,87 @@ func (vm *VM) LastPoppedStackElement() object.Object {
 	return vm.stack[vm.sp]
 }
 
-func (vm *VM) Run() error {
+// Execute the bytecode. Errors are returned as *RuntimeError,
+// located at the source of the instruction that failed.
+// A Go panic while running is also turned into a *RuntimeError,
+// so a bad program can never crash the host process
+func (vm *VM) Run() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = vm.runtimeError(fmt.Sprintf("internal error: %v", r))
+		}
+	}()
+
+	for {
+		err = vm.run()
+		if err == nil {
+			return nil
+		}
+		if !vm.catch(err) {
+			return vm.runtimeError(err.Error())
+		}
+	}
+}
+
+// Unwind the stack to the innermost try block and resume at its catch block,
+// with the error on top of the stack. Report false if there is no try block
+func (vm *VM) catch(err error) bool {
+	if len(vm.handlers) == 0 {
+		return false
+	}
+
+	h := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+	vm.framesIndex = h.framesIndex
+	vm.sp = h.sp
+	// The main loop increments ip before fetching the next instruction
+	vm.currentFrame().ip = h.catchPos - 1
+
+	errObj := &object.Error{Message: err.Error()}
+	return vm.push(errObj.Value()) == nil
+}
+
+// Drop the handlers of the try blocks the current frame is still in,
+// when it returns from inside them
+func (vm *VM) leaveHandlers() {
+	for len(vm.handlers) > 0 && vm.handlers[len(vm.handlers)-1].framesIndex >= vm.framesIndex {
+		vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	}
+}
+
+// Build a runtime error with the current call stack
+func (vm *VM) runtimeError(msg string) *RuntimeError {
+	trace := make([]TraceEntry, 0, vm.framesIndex)
+	for i := vm.framesIndex - 1; i >= 0; i-- {
+		frame := vm.frames[i]
+		trace = append(trace, TraceEntry{Function: frame.Name(), Pos: frame.Position()})
+	}
+
+	err := &RuntimeError{Message: msg, Trace: trace}
+	if len(trace) > 0 {
+		err.Pos = trace[0].Pos
+	}
+	return err
+}
+
+func (vm *VM) run() error {
 	// Increase the instruction pointer and fetch the current instruction
 	// Why not use code.Lookup()? Because then we have to move the byte to here and there
 	// then look up the opcode definition, return it and take it apart
 	// That's a lot more work!
+	//
+	// The current frame and its instructions are kept in locals instead of being looked up
+	// for every instruction. Only calls and returns switch frames, and they refresh them
+	frame := vm.currentFrame()
+	ins := frame.Instructions()
 	var ip int
-	var ins code.Instructions
 	var op code.Opcode
-	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
-		vm.currentFrame().ip++
+	for frame.ip < len(ins)-1 {
+		frame.ip++
 
 		// Helper variables to handle instructions from the current frame.
-		ip = vm.currentFrame().ip
-		ins = vm.currentFrame().Instructions()
+		ip = frame.ip
 		op = code.Opcode(ins[ip])
 
 		switch op {
@@ -89,17 +176,39 @@ func (vm *VM) Run() error {
 			// We do not use ReadOperands() here for number-of-param reason (and performance?)
 			constIndex := code.ReadUint16(ins[ip+1:])
 			// Pointing to the NEXT opcode, not an operand
-			vm.currentFrame().ip += 2
+			frame.ip += 2
 
 			err := vm.push(vm.constants[constIndex])
 			if err != nil {
 				return err
 			}
-		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpPipe, code.OpRShift, code.OpLShift, code.OpAmpersand, code.OpExponent:
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod, code.OpPipe, code.OpRShift, code.OpLShift, code.OpAmpersand, code.OpExponent:
 			err := vm.executeBinaryOperation(op)
 			if err != nil {
 				return err
 			}
+		case code.OpBinaryLocalConstant:
+			operator := code.Opcode(ins[ip+1])
+			localIndex := code.ReadUint8(ins[ip+2:])
+			constIndex := code.ReadUint16(ins[ip+3:])
+			frame.ip += 4
+
+			left := local(vm.stack[frame.basePointer+int(localIndex)])
+			err := vm.executeOperator(operator, left, vm.constants[constIndex])
+			if err != nil {
+				return err
+			}
+		case code.OpBinaryConstantLocal:
+			operator := code.Opcode(ins[ip+1])
+			constIndex := code.ReadUint16(ins[ip+2:])
+			localIndex := code.ReadUint8(ins[ip+4:])
+			frame.ip += 4
+
+			right := local(vm.stack[frame.basePointer+int(localIndex)])
+			err := vm.executeOperator(operator, vm.constants[constIndex], right)
+			if err != nil {
+				return err
+			}
 		case code.OpTrue:
 			err := vm.push(True)
 			if err != nil {
@@ -112,7 +221,17 @@ func (vm *VM) Run() error {
 			}
 		case code.OpPop:
 			vm.pop()
-		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan:
+		case code.OpDup:
+			n := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+
+			for _, obj := range vm.stack[vm.sp-n : vm.sp] {
+				err := vm.push(obj)
+				if err != nil {
+					return err
+				}
+			}
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterThanOrEqual:
 			err := vm.executeComparison(op)
 			if err != nil {
 				return err
@@ -131,18 +250,18 @@ func (vm *VM) Run() error {
 			// Set the instruction pointer (ip)
 			// to right before the instruction we want to execute
 			pos := int(code.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip = pos - 1
+			frame.ip = pos - 1
 		case code.OpJumpNotTruthy:
 			pos := int(code.ReadUint16(ins[ip+1:]))
 			// Again pointing to the next opcode
 			// just like how OpConstant does that
-			vm.currentFrame().ip += 2
+			frame.ip += 2
 
 			condition := vm.pop()
 			if !isTruthy(condition) {
 				// Set the instruction pointer right before the target instruction
 				// then let the for-loop do its work
-				vm.currentFrame().ip = pos - 1
+				frame.ip = pos - 1
 			}
 		case code.OpNull:
 			err := vm.push(Null)
@@ -154,22 +273,25 @@ func (vm *VM) Run() error {
 			globalIndex := code.ReadUint16(ins[ip+1:])
 
 			// Increment two bytes for the next instruction
-			vm.currentFrame().ip += 2
+			frame.ip += 2
 
 			vm.globals[globalIndex] = vm.pop()
 		case code.OpSetLocal:
 			localIndex := code.ReadUint8(ins[ip+1:])
 			// Operand for local bindings is only 1-byte wide.
-			vm.currentFrame().ip += 1
+			frame.ip += 1
 
-			// Get the frame of the callee function
-			frame := vm.currentFrame()
 			// Save the binding to the stack frame
 			// using the base pointer and the index of the binding as an offset
-			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+			slot := &vm.stack[frame.basePointer+int(localIndex)]
+			if cell, ok := (*slot).(*object.Cell); ok {
+				cell.Value = vm.pop()
+			} else {
+				*slot = vm.pop()
+			}
 		case code.OpGetGlobal:
 			globalIndex := code.ReadUint16(ins[ip+1:])
-			vm.currentFrame().ip += 2
+			frame.ip += 2
 
 			err := vm.push(vm.globals[globalIndex])
 			if err != nil {
@@ -177,16 +299,23 @@ func (vm *VM) Run() error {
 			}
 		case code.OpGetLocal:
 			localIndex := code.ReadUint8(ins[ip+1:])
-			vm.currentFrame().ip += 1
+			frame.ip += 1
 
-			frame := vm.currentFrame()
-			err := vm.push(vm.stack[frame.basePointer+int(localIndex)])
+			err := vm.push(local(vm.stack[frame.basePointer+int(localIndex)]))
+			if err != nil {
+				return err
+			}
+		case code.OpGetLocalCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			err := vm.push(cellOf(&vm.stack[frame.basePointer+int(localIndex)]))
 			if err != nil {
 				return err
 			}
 		case code.OpArray:
 			numElems := int(code.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
+			frame.ip += 2
 			// Elements might be scattered around the stack,
 			// not necessarily at the top of the stack going down
 			// N == endIndex - startIndex
@@ -198,9 +327,55 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpTuple:
+			numElems := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			elems := make([]object.Object, numElems)
+			copy(elems, vm.stack[vm.sp-numElems:vm.sp])
+			vm.sp = vm.sp - numElems
+
+			err := vm.push(&object.Tuple{Elements: elems})
+			if err != nil {
+				return err
+			}
+		case code.OpUnpackTuple:
+			numElems := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			elems, msg := object.TupleElements(vm.pop(), numElems)
+			err := vm.pushUnpacked(elems, msg)
+			if err != nil {
+				return err
+			}
+		case code.OpUnpackArray:
+			numElems := int(code.ReadUint16(ins[ip+1:]))
+			rest := code.ReadUint8(ins[ip+3:]) == 1
+			frame.ip += 3
+
+			elems, msg := object.ArrayElements(vm.pop(), numElems, rest)
+			err := vm.pushUnpacked(elems, msg)
+			if err != nil {
+				return err
+			}
+		case code.OpUnpackHash:
+			numKeys := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			keys := make([]string, numKeys)
+			for i, key := range vm.stack[vm.sp-numKeys : vm.sp] {
+				keys[i] = key.(*object.String).Value
+			}
+			vm.sp = vm.sp - numKeys
+
+			values, msg := object.HashValues(vm.pop(), keys)
+			err := vm.pushUnpacked(values, msg)
+			if err != nil {
+				return err
+			}
 		case code.OpHash:
 			numElems := int(code.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
+			frame.ip += 2
 
 			hash, err := vm.buildHash(vm.sp-numElems, vm.sp)
 			if err != nil {
@@ -222,20 +397,88 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+
+			err := vm.executeSetIndex(left, index, value)
+			if err != nil {
+				return err
+			}
+		case code.OpStruct:
+			numFields := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			// The type sits below the names and values of the fields
+			start := vm.sp - numFields*2
+			s, err := vm.buildStruct(vm.stack[start-1], start, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp = start - 1
+
+			err = vm.push(s)
+			if err != nil {
+				return err
+			}
+		case code.OpGetField:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			err := vm.executeGetField(vm.pop(), vm.constants[constIndex])
+			if err != nil {
+				return err
+			}
+		case code.OpSetField:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			value := vm.pop()
+			s, idx, err := vm.structField(vm.pop(), vm.constants[constIndex])
+			if err != nil {
+				return err
+			}
+			s.Values[idx] = value
+
+			// Assignment is an expression
+			err = vm.push(value)
+			if err != nil {
+				return err
+			}
 		case code.OpCall:
 			// Arguments now sit on top of function object on the stack
 			numArgs := code.ReadUint8(ins[ip+1:])
-			vm.currentFrame().ip += 1
+			frame.ip += 1
 
 			err := vm.executeCall(int(numArgs))
 			if err != nil {
 				return err
 			}
+			frame = vm.currentFrame()
+			ins = frame.Instructions()
+		case code.OpTailCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			err := vm.executeTailCall(int(numArgs))
+			if err != nil {
+				return err
+			}
+			frame = vm.currentFrame()
+			ins = frame.Instructions()
 		case code.OpReturnValue:
 			returnValue := vm.pop()
+			vm.leaveHandlers()
+
+			// A return at the top level ends the program, just like in the evaluator.
+			// The popped value stays right above the stack pointer as the result
+			if vm.framesIndex == 1 {
+				return nil
+			}
 
 			// Take the frame for the function call off the stack
-			frame := vm.popFrame()
+			vm.popFrame()
 			// At this point the base pointer is pointing to the just-executed function,
 			// so when we pop the frame of the function off the stack, we reset the stack pointer as well.
 			// It's also an optimization: When we get rid off the local bindings, we leave the just-executed function on the stack.
@@ -246,18 +489,39 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+			frame = vm.currentFrame()
+			ins = frame.Instructions()
 		case code.OpReturn:
-			frame := vm.popFrame()
+			vm.leaveHandlers()
+			if vm.framesIndex == 1 {
+				vm.stack[vm.sp] = Null
+				return nil
+			}
+
+			vm.popFrame()
 			vm.sp = frame.basePointer - 1
 
 			err := vm.push(Null)
 			if err != nil {
 				return err
 			}
+			frame = vm.currentFrame()
+			ins = frame.Instructions()
+		case code.OpTry:
+			catchPos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			vm.handlers = append(vm.handlers, handler{
+				framesIndex: vm.framesIndex,
+				sp:          vm.sp,
+				catchPos:    catchPos,
+			})
+		case code.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
 		case code.OpGetBuiltin:
 			builtinIndex := code.ReadUint8(ins[ip+1:])
 			// Point to the next opcode
-			vm.currentFrame().ip += 1
+			frame.ip += 1
 
 			definition := object.Builtins[builtinIndex]
 
@@ -270,7 +534,7 @@ func (vm *VM) Run() error {
 			constIndex := code.ReadUint16(ins[ip+1:])
 			// Read the array of free vars
 			numFree := code.ReadUint8(ins[ip+3:])
-			vm.currentFrame().ip += 3
+			frame.ip += 3
 
 			err := vm.pushClosure(int(constIndex), int(numFree))
 			if err != nil {
@@ -279,15 +543,43 @@ func (vm *VM) Run() error {
 		case code.OpGetFree:
 			// Decode the operand and use it as the index to the Free slice
 			freeIndex := code.ReadUint8(ins[ip+1:])
-			vm.currentFrame().ip += 1
+			frame.ip += 1
 
-			currentClosure := vm.currentFrame().cl
-			err := vm.push(currentClosure.Free[freeIndex])
+			currentClosure := frame.cl
+			err := vm.push(local(currentClosure.Free[freeIndex]))
 			if err != nil {
 				return err
 			}
+		case code.OpSetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			// Free variables live in cells shared with the scope they were captured from,
+			// except for the closure itself in recursive functions
+			slot := &frame.cl.Free[freeIndex]
+			if cell, ok := (*slot).(*object.Cell); ok {
+				cell.Value = vm.pop()
+			} else {
+				*slot = vm.pop()
+			}
+		case code.OpGetFreeCell:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			err := vm.push(cellOf(&frame.cl.Free[freeIndex]))
+			if err != nil {
+				return err
+			}
+		case code.OpJumpIfPassed:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			paramIndex := int(code.ReadUint8(ins[ip+3:]))
+			frame.ip += 3
+
+			if paramIndex < frame.numArgs {
+				frame.ip = pos - 1
+			}
 		case code.OpCurrentClosure:
-			currentClosure := vm.currentFrame().cl
+			currentClosure := frame.cl
 			err := vm.push(currentClosure)
 			if err != nil {
 				return err
@@ -302,6 +594,20 @@ func (vm *VM) executeBinaryOperation(op code.Opcode) error {
 	right := vm.pop()
 	left := vm.pop()
 
+	return vm.binaryOperation(op, left, right)
+}
+
+// Apply the operator of a superinstruction to operands that were never pushed
+func (vm *VM) executeOperator(op code.Opcode, left, right object.Object) error {
+	switch op {
+	case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterThanOrEqual:
+		return vm.comparison(op, left, right)
+	default:
+		return vm.binaryOperation(op, left, right)
+	}
+}
+
+func (vm *VM) binaryOperation(op code.Opcode, left, right object.Object) error {
 	rightType := right.Type()
 	leftType := left.Type()
 
@@ -310,6 +616,9 @@ func (vm *VM) executeBinaryOperation(op code.Opcode) error {
 		return vm.executeBinaryIntegerOperation(op, left, right)
 	case rightType == object.STRING_OBJ && leftType == object.STRING_OBJ:
 		return vm.executeBinaryStringOperation(op, left, right)
+	// Floats and mixed integer/float operands are computed as floats
+	case object.IsNumeric(left) && object.IsNumeric(right):
+		return vm.executeBinaryFloatOperation(op, object.ToFloat(left), object.ToFloat(right))
 	default:
 		return fmt.Errorf("unsupported types for binary operation: %s %s",
 			leftType, rightType)
@@ -330,12 +639,26 @@ func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.O
 	case code.OpMul:
 		result = leftValue * rightValue
 	case code.OpDiv:
+		if rightValue == 0 {
+			return fmt.Errorf("division by zero")
+		}
 		result = leftValue / rightValue
+	case code.OpMod:
+		if rightValue == 0 {
+			return fmt.Errorf("modulo by zero")
+		}
+		result = leftValue % rightValue
 	case code.OpPipe:
 		result = leftValue | rightValue
 	case code.OpRShift:
+		if rightValue < 0 {
+			return fmt.Errorf("negative shift count: %d", rightValue)
+		}
 		result = leftValue >> rightValue
 	case code.OpLShift:
+		if rightValue < 0 {
+			return fmt.Errorf("negative shift count: %d", rightValue)
+		}
 		result = leftValue << rightValue
 	case code.OpAmpersand:
 		result = leftValue & rightValue
@@ -345,7 +668,39 @@ func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.O
 		return fmt.Errorf("unknown integer operator: %d", op)
 	}
 
-	return vm.push(&object.Integer{Value: result})
+	return vm.push(object.NewInteger(result))
+}
+
+// Follow the rounding rules of the evaluator:
+// sums and quotients are rounded to object.FloatPrecision decimal places
+func (vm *VM) executeBinaryFloatOperation(op code.Opcode, left, right *object.Float) error {
+	leftValue := left.Value
+	rightValue := right.Value
+
+	var result float64
+
+	switch op {
+	case code.OpAdd:
+		result = object.ToFixed(leftValue+rightValue, object.FloatPrecision)
+	case code.OpSub:
+		result = leftValue - rightValue
+	case code.OpMul:
+		result = leftValue * rightValue
+	case code.OpDiv:
+		if rightValue == 0 {
+			return fmt.Errorf("division by zero")
+		}
+		result = object.ToFixed(leftValue/rightValue, object.FloatPrecision)
+	case code.OpMod:
+		if rightValue == 0 {
+			return fmt.Errorf("modulo by zero")
+		}
+		result = object.ToFixed(math.Mod(leftValue, rightValue), object.FloatPrecision)
+	default:
+		return fmt.Errorf("unknown float operator: %d", op)
+	}
+
+	return vm.push(&object.Float{Value: result})
 }
 
 func (vm *VM) executeBinaryStringOperation(
@@ -355,15 +710,17 @@ func (vm *VM) executeBinaryStringOperation(
 	if op != code.OpAdd {
 		return fmt.Errorf("unknown string operator: %d", op)
 	}
-	leftValue := left.(*object.String).Value
-	rightValue := right.(*object.String).Value
-	return vm.push(&object.String{Value: leftValue + rightValue})
+	return vm.push(object.ConcatStrings(left.(*object.String), right.(*object.String)))
 }
 
 func (vm *VM) executeComparison(op code.Opcode) error {
 	right := vm.pop()
 	left := vm.pop()
 
+	return vm.comparison(op, left, right)
+}
+
+func (vm *VM) comparison(op code.Opcode, left, right object.Object) error {
 	rightType := right.Type()
 	leftType := left.Type()
 
@@ -371,6 +728,18 @@ func (vm *VM) executeComparison(op code.Opcode) error {
 		return vm.executeIntegerComparison(op, left, right)
 	}
 
+	if object.IsNumeric(left) && object.IsNumeric(right) {
+		return vm.executeFloatComparison(op, object.ToFloat(left), object.ToFloat(right))
+	}
+
+	if leftType == object.STRING_OBJ && rightType == object.STRING_OBJ {
+		return vm.executeStringComparison(op, left.(*object.String), right.(*object.String))
+	}
+
+	if leftType == object.TUPLE_OBJ && rightType == object.TUPLE_OBJ {
+		return vm.executeTupleComparison(op, left, right)
+	}
+
 	// Comparing boolean objects like true == false
 	switch op {
 	case code.OpEqual:
@@ -383,6 +752,30 @@ func (vm *VM) executeComparison(op code.Opcode) error {
 	}
 }
 
+// Tuples are values, so they are compared element by element
+func (vm *VM) executeTupleComparison(op code.Opcode, left, right object.Object) error {
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(object.Equal(left, right)))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(!object.Equal(left, right)))
+	default:
+		return fmt.Errorf("unknown operator: %d (%s %s)", op, left.Type(), right.Type())
+	}
+}
+
+// Strings are compared by value, not by identity like booleans
+func (vm *VM) executeStringComparison(op code.Opcode, left, right *object.String) error {
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(left.Value == right.Value))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(left.Value != right.Value))
+	default:
+		return fmt.Errorf("unknown operator: %d (%s %s)", op, left.Type(), right.Type())
+	}
+}
+
 func (vm *VM) executeIntegerComparison(op code.Opcode, left, right object.Object) error {
 	leftValue := left.(*object.Integer).Value
 	rightValue := right.(*object.Integer).Value
@@ -394,6 +787,28 @@ func (vm *VM) executeIntegerComparison(op code.Opcode, left, right object.Object
 		return vm.push(nativeBoolToBooleanObject(rightValue != leftValue))
 	case code.OpGreaterThan:
 		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	default:
+		return fmt.Errorf("unknown operator: %d (%s %s)",
+			op, left.Type(), right.Type())
+	}
+}
+
+// Floats are equal when they are within object.FloatEpsilon of each other
+func (vm *VM) executeFloatComparison(op code.Opcode, left, right *object.Float) error {
+	leftValue := left.Value
+	rightValue := right.Value
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(math.Abs(leftValue-rightValue) < object.FloatEpsilon))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(math.Abs(leftValue-rightValue) >= object.FloatEpsilon))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue || math.Abs(leftValue-rightValue) < object.FloatEpsilon))
 	default:
 		return fmt.Errorf("unknown operator: %d (%s %s)",
 			op, left.Type(), right.Type())
@@ -424,6 +839,11 @@ func (vm *VM) executeBangOperator() error {
 
 func (vm *VM) executeUnaryOperation(op code.Opcode) error {
 	operand := vm.pop()
+
+	if float, ok := operand.(*object.Float); ok && op == code.OpMinus {
+		return vm.push(&object.Float{Value: -float.Value})
+	}
+
 	if operand.Type() != object.INTERGER_OBJ {
 		return fmt.Errorf("unsupported type for negation: %s", operand.Type())
 	}
@@ -431,9 +851,9 @@ func (vm *VM) executeUnaryOperation(op code.Opcode) error {
 	val := operand.(*object.Integer).Value
 	switch op {
 	case code.OpMinus:
-		return vm.push(&object.Integer{Value: -val})
+		return vm.push(object.NewInteger(-val))
 	case code.OpTilde:
-		return vm.push(&object.Integer{Value: ^val})
+		return vm.push(object.NewInteger(^val))
 	case code.OpPreInc, code.OpPreDec:
 		return vm.executePrefixIncrementDecrementOperator(op, val)
 	case code.OpPostInc, code.OpPostDec:
@@ -445,7 +865,7 @@ func (vm *VM) executeUnaryOperation(op code.Opcode) error {
 
 // Push the object from the constant pool to the stack
 func (vm *VM) push(o object.Object) error {
-	if vm.sp > StackSize {
+	if vm.sp >= StackSize {
 		return fmt.Errorf("stack overflow")
 	}
 
@@ -470,12 +890,11 @@ func (vm *VM) executePrefixIncrementDecrementOperator(op code.Opcode, val int64)
 	case code.OpPreDec:
 		newVal = val - 1
 	}
-	return vm.push(&object.Integer{Value: newVal})
+	return vm.push(object.NewInteger(newVal))
 }
 
 func (vm *VM) executePostfixIncrementDecrementOperator(_ code.Opcode, val int64) error {
-	// TODO: Set to environment later
-	return vm.push(&object.Integer{Value: val})
+	return vm.push(object.NewInteger(val))
 }
 
 func isTruthy(obj object.Object) bool {
@@ -500,6 +919,20 @@ func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
 	return &object.Array{Elements: elems}
 }
 
+// Push the parts of a value taken apart by a pattern, or fail with why it could not be
+func (vm *VM) pushUnpacked(parts []object.Object, msg string) error {
+	if msg != "" {
+		return fmt.Errorf("%s", msg)
+	}
+	for _, part := range parts {
+		err := vm.push(part)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
 	hashedPairs := make(map[object.HashKey]object.HashPair)
 	// K-V so we increment by 2
@@ -509,7 +942,7 @@ func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
 		value := vm.stack[i+1]
 
 		pair := object.HashPair{Key: key, Value: value}
-		hashKey, ok := key.(object.Hashable)
+		hashKey, ok := object.AsHashable(key)
 		if !ok {
 			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
 		}
@@ -518,10 +951,72 @@ func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
 	return &object.Hash{Pairs: hashedPairs}, nil
 }
 
+// Create a struct of type typ from the names and values of the fields between startIndex and endIndex
+func (vm *VM) buildStruct(typ object.Object, startIndex, endIndex int) (object.Object, error) {
+	st, ok := typ.(*object.StructType)
+	if !ok {
+		return nil, fmt.Errorf("not a struct type: %s", typ.Type())
+	}
+
+	// Fields left out are null
+	values := make([]object.Object, len(st.Fields))
+	for i := range values {
+		values[i] = Null
+	}
+
+	for i := startIndex; i < endIndex; i += 2 {
+		field := vm.stack[i].(*object.String).Value
+		idx := st.FieldIndex(field)
+		if idx < 0 {
+			return nil, fmt.Errorf("struct %s has no field %s", st.Name, field)
+		}
+		values[idx] = vm.stack[i+1]
+	}
+
+	return &object.Struct{Def: st, Values: values}, nil
+}
+
+// Push a field of a struct, or a method of any other value
+func (vm *VM) executeGetField(obj, name object.Object) error {
+	if _, ok := obj.(*object.Struct); !ok {
+		field := name.(*object.String).Value
+		if method := object.GetMethod(obj, field); method != nil {
+			return vm.push(method)
+		}
+		return fmt.Errorf("%s has no method %s", obj.Type(), field)
+	}
+
+	s, idx, err := vm.structField(obj, name)
+	if err != nil {
+		return err
+	}
+	return vm.push(s.Values[idx])
+}
+
+// Find where a field is kept in the values of a struct
+func (vm *VM) structField(obj, name object.Object) (*object.Struct, int, error) {
+	s, ok := obj.(*object.Struct)
+	if !ok {
+		return nil, 0, fmt.Errorf("field access not supported: %s", obj.Type())
+	}
+
+	field := name.(*object.String).Value
+	idx := s.Def.FieldIndex(field)
+	if idx < 0 {
+		return nil, 0, fmt.Errorf("struct %s has no field %s", s.Def.Name, field)
+	}
+
+	return s, idx, nil
+}
+
 func (vm *VM) executeIndexExpression(left, index object.Object) error {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTERGER_OBJ:
 		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTERGER_OBJ:
+		return vm.executeStringIndex(left, index)
+	case left.Type() == object.TUPLE_OBJ && index.Type() == object.INTERGER_OBJ:
+		return vm.executeTupleIndex(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return vm.executeHashIndex(left, index)
 	default:
@@ -541,9 +1036,30 @@ func (vm *VM) executeArrayIndex(array, index object.Object) error {
 	return vm.push(arrayObject.Elements[i])
 }
 
+func (vm *VM) executeTupleIndex(tuple, index object.Object) error {
+	elements := tuple.(*object.Tuple).Elements
+	i := index.(*object.Integer).Value
+
+	if i < 0 || i >= int64(len(elements)) {
+		return vm.push(Null)
+	}
+	return vm.push(elements[i])
+}
+
+// Index a string by characters and push the character as a string
+func (vm *VM) executeStringIndex(str, index object.Object) error {
+	i := index.(*object.Integer).Value
+
+	ch, ok := str.(*object.String).CharAt(i)
+	if !ok {
+		return vm.push(Null)
+	}
+	return vm.push(ch)
+}
+
 func (vm *VM) executeHashIndex(hash, index object.Object) error {
 	hashObject := hash.(*object.Hash)
-	key, ok := index.(object.Hashable)
+	key, ok := object.AsHashable(index)
 	if !ok {
 		return fmt.Errorf("unusable as hash key: %s", index.Type())
 	}
@@ -554,17 +1070,56 @@ func (vm *VM) executeHashIndex(hash, index object.Object) error {
 	return vm.push(pair.Value)
 }
 
+// Update an element of an array or a hash in place
+// and push the assigned value so assignments can be chained
+func (vm *VM) executeSetIndex(left, index, value object.Object) error {
+	switch left := left.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			return fmt.Errorf("array index must be INTEGER, got %s", index.Type())
+		}
+		if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return fmt.Errorf("index out of range: %d", i.Value)
+		}
+		left.Elements[i.Value] = value
+	case *object.Hash:
+		key, ok := object.AsHashable(index)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s", index.Type())
+		}
+		left.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: value}
+	default:
+		return fmt.Errorf("index assignment not supported: %s", left.Type())
+	}
+
+	return vm.push(value)
+}
+
 func (vm *VM) currentFrame() *Frame {
 	return vm.frames[vm.framesIndex-1]
 }
 
 // Push a frame to the stack frame
-func (vm *VM) pushFrame(f *Frame) {
-	vm.frames[vm.framesIndex] = f
+// Push a frame for a call to cl. The frames of calls that returned are reused,
+// so calling a function does not allocate
+func (vm *VM) pushFrame(cl *object.Closure, basePointer int) (*Frame, error) {
+	if vm.framesIndex >= MaxFrames {
+		return nil, fmt.Errorf("call stack overflow: more than %d nested calls", MaxFrames)
+	}
+
+	frame := vm.frames[vm.framesIndex]
+	if frame == nil {
+		frame = NewFrame(cl, basePointer)
+		vm.frames[vm.framesIndex] = frame
+	} else {
+		*frame = Frame{cl: cl, ip: -1, basePointer: basePointer}
+	}
 	vm.framesIndex++
+
+	return frame, nil
 }
 
-// Pop a frame off a stack frame
 func (vm *VM) popFrame() *Frame {
 	vm.framesIndex--
 	return vm.frames[vm.framesIndex]
@@ -579,27 +1134,123 @@ func (vm *VM) executeCall(numArgs int) error {
 		return vm.callClosure(callee, numArgs)
 	case *object.Builtin:
 		return vm.callBuiltin(callee, numArgs)
+	case *object.BoundMethod:
+		return vm.callMethod(callee, numArgs)
 	default:
 		return fmt.Errorf("calling non-function and non-built-in")
 	}
 }
 
+// Call a closure in place of the function that is running,
+// so self-recursion in tail position does not grow the frames or the stack.
+// Everything else is a normal call, and the OpReturnValue following OpTailCall, maybe after a jump, returns its result
+func (vm *VM) executeTailCall(numArgs int) error {
+	callee, ok := vm.stack[vm.sp-1-numArgs].(*object.Closure)
+	if !ok || vm.framesIndex == 1 {
+		return vm.executeCall(numArgs)
+	}
+	err := checkArity(callee.Fn, numArgs)
+	if err != nil {
+		return err
+	}
+
+	// The caller is done, so are the try blocks it entered
+	vm.leaveHandlers()
+
+	// Move the callee and its arguments down to where the caller and its arguments were
+	frame := vm.currentFrame()
+	copy(vm.stack[frame.basePointer-1:], vm.stack[vm.sp-1-numArgs:vm.sp])
+
+	passed, err := vm.layOutLocals(callee.Fn, frame.basePointer, numArgs)
+	if err != nil {
+		return err
+	}
+
+	frame.cl = callee
+	frame.ip = -1
+	frame.numArgs = passed
+
+	return nil
+}
+
 func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
-	if numArgs != cl.Fn.NumParameters {
-		return fmt.Errorf("wrong number of arguments: want=%d, got=%d",
-			cl.Fn.NumParameters, numArgs)
+	err := checkArity(cl.Fn, numArgs)
+	if err != nil {
+		return err
 	}
 	// Store the current stack pointer as the base/frame pointer
 	// so we know somewhere to resume when we are done with the function call.
 	// We also need to subtract the argument indexes so the base pointer does not point to empty stack slots at the top.
-	frame := NewFrame(cl, vm.sp-numArgs)
-	vm.pushFrame(frame)
-	// Create a "hole" - memory region of the stack for the local bindings of the OpCall being executed
-	vm.sp = frame.basePointer + cl.Fn.NumLocals
+	basePointer := vm.sp - numArgs
+	passed, err := vm.layOutLocals(cl.Fn, basePointer, numArgs)
+	if err != nil {
+		return err
+	}
+	frame, err := vm.pushFrame(cl, basePointer)
+	if err != nil {
+		return err
+	}
+	frame.numArgs = passed
 
 	return nil
 }
 
+func checkArity(fn *object.CompiledFunction, numArgs int) error {
+	if msg := object.ArityError(fn.NumParameters, fn.NumDefaults, fn.Variadic, numArgs); msg != "" {
+		return fmt.Errorf("%s", msg)
+	}
+	return nil
+}
+
+// Turn the numArgs arguments starting at basePointer into the locals of a call to fn:
+// collect the ones after the parameters into the rest parameter, if fn has one,
+// and make room for the other locals. Return how many parameters got an argument,
+// the function computes the defaults of the others itself
+func (vm *VM) layOutLocals(fn *object.CompiledFunction, basePointer, numArgs int) (int, error) {
+	if basePointer+fn.NumLocals >= StackSize {
+		return 0, fmt.Errorf("stack overflow")
+	}
+
+	var rest *object.Array
+	if fn.Variadic {
+		rest = &object.Array{Elements: []object.Object{}}
+		if numArgs > fn.NumParameters {
+			rest.Elements = append(rest.Elements, vm.stack[basePointer+fn.NumParameters:basePointer+numArgs]...)
+			numArgs = fn.NumParameters
+		}
+	}
+
+	// An earlier call may have left cells in the slots of the other locals,
+	// which assigning to them would write through
+	clear(vm.stack[basePointer+numArgs : basePointer+fn.NumLocals])
+	if rest != nil {
+		vm.stack[basePointer+fn.NumParameters] = rest
+	}
+
+	// Create a "hole" - memory region of the stack for the local bindings of the OpCall being executed
+	vm.sp = basePointer + fn.NumLocals
+
+	return numArgs, nil
+}
+
+// Return the value of a local or free variable, which is in a cell once a closure captured it
+func local(obj object.Object) object.Object {
+	if cell, ok := obj.(*object.Cell); ok {
+		return cell.Value
+	}
+	return obj
+}
+
+// Return the cell of a variable, moving the variable into one if it is not in a cell yet
+func cellOf(slot *object.Object) *object.Cell {
+	cell, ok := (*slot).(*object.Cell)
+	if !ok {
+		cell = &object.Cell{Value: *slot}
+		*slot = cell
+	}
+	return cell
+}
+
 func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	args := vm.stack[vm.sp-numArgs : vm.sp]
 
@@ -607,6 +1258,11 @@ func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	// Take the builtin function and its arguments off the stack
 	vm.sp = vm.sp - numArgs - 1
 
+	// A failed builtin raises a runtime error, so try/catch can recover from it
+	if errObj, ok := result.(*object.Error); ok {
+		return fmt.Errorf("%s", errObj.Message)
+	}
+
 	if result != nil {
 		vm.push(result)
 	} else {
@@ -616,6 +1272,21 @@ func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	return nil
 }
 
+// Call the builtin of a method with the receiver as its first argument,
+// which we slip in on the stack right before the other arguments
+func (vm *VM) callMethod(method *object.BoundMethod, numArgs int) error {
+	if vm.sp >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+
+	args := vm.sp - numArgs
+	copy(vm.stack[args+1:], vm.stack[args:vm.sp])
+	vm.stack[args] = method.Receiver
+	vm.sp++
+
+	return vm.callBuiltin(method.Builtin, numArgs+1)
+}
+
 func (vm *VM) pushClosure(constIndex, numFree int) error {
 	constant := vm.constants[constIndex]
 	fn, ok := constant.(*object.CompiledFunction)
@@ -2,10 +2,12 @@ package vm
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"s8/ast"
 	"s8/compiler"
+	"s8/evaluator"
 	"s8/lexer"
 	"s8/object"
 	"s8/parser"
@@ -35,13 +37,13 @@ func TestIntegerArithmetic(t *testing.T) {
 		{"5 * 2 + 10", 20},
 		{"5 + 2 * 10", 25},
 		{"5 * (2 + 10)", 60},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"6 % 3", 0},
+		{"1 + 7 % 4 * 2", 7},
 		{"-5", -5},
 		{"-10", -10},
 		{"~5", -6},
-		{"++5", 6},
-		{"--5", 4},
-		{"5++", 5},
-		{"5--", 5},
 		{"-50 + 100 + -50", 0},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
 	}
@@ -49,6 +51,84 @@ func TestIntegerArithmetic(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestFloatArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"5.0", 5.0},
+		{"-5.25", -5.25},
+		{"5.5 + 5.25 + 5.125 + 5.625 - 10.5", 11.0},
+		{"2.5 * 2.5", 6.25},
+		{"-50.5 + 100.25 + -50.25", -0.5},
+		{"5.25 + 2.5 * 10.125", 30.5625},
+		{"50.5 / 2.5 * 2.25 + 10.125", 55.575},
+		{"(5.5 + 10.25 * 2.5 + 15.75 / 3.25) * 2.5 + -10.25", 79.677885},
+		{"1.23456789", 1.234568},
+		{"1.0 / 3.0", 0.333333},
+		{"0.1 + 0.2", 0.3},
+		// Mixed integer and float operands
+		{"1 + 2.5", 3.5},
+		{"2.5 + 1", 3.5},
+		{"10 - 0.5", 9.5},
+		{"2 * 1.25", 2.5},
+		{"1 / 3.0", 0.333333},
+		{"let x = 1.5; -x", -1.5},
+		{"5.5 % 2", 1.5},
+		{"7 % 2.5", 2.0},
+		{"-5.5 % 2.0", -1.5},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFloatComparisons(t *testing.T) {
+	tests := []vmTestCase{
+		{"1.5 < 2.5", true},
+		{"1.5 > 2.5", false},
+		{"0.1 + 0.2 == 0.3", true},
+		{"0.1 + 0.2 != 0.3", false},
+		{"1 < 1.5", true},
+		{"2.5 > 3", false},
+		{"1 == 1.0", true},
+		{"1.0 != 1", false},
+		{"1.5 <= 1.5", true},
+		{"1.5 >= 2.5", false},
+		{"0.1 + 0.2 <= 0.3", true},
+		{"0.1 + 0.2 >= 0.3", true},
+		{"1 <= 1.0", true},
+		{"2 >= 2.5", false},
+		{"2.5 >= 2", true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFloatErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{"1.0 / 0.0", "1:5: division by zero"},
+		{"1 % 0", "1:3: modulo by zero"},
+		{"1.5 % 0", "1:5: modulo by zero"},
+		{"let f = funk(x) { x % 0.0 }; f(3)", "1:21: modulo by zero"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
 func TestBooleanExpressions(t *testing.T) {
 	tests := []vmTestCase{
 		{"true", true},
@@ -57,6 +137,13 @@ func TestBooleanExpressions(t *testing.T) {
 		{"1 > 2", false},
 		{"1 < 1", false},
 		{"1 > 1", false},
+		{"1 <= 2", true},
+		{"2 <= 1", false},
+		{"1 <= 1", true},
+		{"1 >= 2", false},
+		{"2 >= 1", true},
+		{"1 >= 1", true},
+		{"1 + 1 >= 2 == true", true},
 		{"1 == 1", true},
 		{"1 != 1", false},
 		{"1 == 2", false},
@@ -98,6 +185,71 @@ func TestConditionals(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestLogicalExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"true || false", true},
+		// Same truthiness as if: only false and null are falsy
+		{"1 && 0", true},
+		{`"" || false`, true},
+		{"if (false) { 1 } || false", false},
+		{"1 > 2 || 3 > 2 && 4 > 3", true},
+		{"let a = 1; let b = 2; if (a > 0 && b > 0) { 10 } else { 20 }", 10},
+		// The right operand only runs if it can change the result
+		{"let x = 0; false && (x = 1); x", 0},
+		{"let x = 0; true && (x = 1); x", 1},
+		{"let x = 0; true || (x = 1); x", 0},
+		{"let x = 0; false || (x = 1); x", 1},
+		{"false && (1 + true)", false},
+		{"true || [][0][0]", true},
+		// The whole logical expression is the condition of a ternary
+		{"false && true ? false : true", true},
+		{"true || false ? false : true", false},
+		{"1 > 2 || 2 > 1 ? 10 : 20", 10},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestTernaryExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		// Basic ternary operations
+		{"true ? 10 : 20", 10},
+		{"false ? 10 : 20", 20},
+		// Nested ternary operations
+		{"true ? (false ? 10 : 20) : 30", 20},
+		{"false ? 10 : (true ? 20 : 30)", 20},
+		{"false ? 1 : false ? 2 : 3", 3},
+		{"true ? false ? 1 : 2 : 3", 2},
+		// With expressions as condition
+		{"1 == 1 ? 10 : 20", 10},
+		{"1 != 1 ? 10 : 20", 20},
+		{"5 > 3 ? 10 : 20", 10},
+		{"5 < 3 ? 10 : 20", 20},
+		{"1 ? 10 : 20", 10},
+		// With expressions as consequences and alternatives
+		{"true ? 5 + 5 : 20", 10},
+		{"false ? 10 : 15 + 5", 20},
+		{"1 + (true ? 1 : 2) + 1", 3},
+		// With string operations
+		{`true ? "yes" : "no"`, "yes"},
+		{`false ? "yes" : "no"`, "no"},
+		// With identifiers
+		{"let a = 5; let b = 10; a > b ? a : b", 10},
+		{"let a = 15; let b = 10; a > b ? a : b", 15},
+		// With function calls
+		{"let f = funk(x) { x * 2 }; true ? f(5) : 20", 10},
+		{"let f = funk(x) { x * 2 }; false ? 20 : f(5)", 10},
+		{"let max = funk(a, b) { a > b ? a : b }; max(3, 7)", 7},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestGlobalLetStatements(t *testing.T) {
 	tests := []vmTestCase{
 		{"let one = 1; one", 1},
@@ -112,6 +264,39 @@ func TestStringExpressions(t *testing.T) {
 		{`"monkey"`, "monkey"},
 		{`"mon" + "key"`, "monkey"},
 		{`"mon" + "key" + "banana"`, "monkeybanana"},
+		{`"héllo, " + "世界"`, "héllo, 世界"},
+		// Compared by value, not by which constant they come from
+		{`"mon" + "key" == "monkey"`, true},
+		{`let a = "x"; let b = "x"; a == b`, true},
+		{`"a" != "b"`, true},
+		{`"a" == "b"`, false},
+	}
+	runVmTests(t, tests)
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []vmTestCase{
+		{`"a\tb\n"`, "a\tb\n"},
+		{`"say \"hi\""`, `say "hi"`},
+		{`len("\u{1F44B}\n")`, 2},
+		{`"\\"[0]`, `\`},
+		{"`raw\n\\n` + \"!\"", "raw\n\\n!"},
+	}
+	runVmTests(t, tests)
+}
+
+func TestUnicodeStrings(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("héllo")`, 5},
+		{`len("世界")`, 2},
+		{`len("👋🏽")`, 2},
+		{`"héllo"[1]`, "é"},
+		{`"世界"[1]`, "界"},
+		{`let s = "abc"; s[len(s) - 1]`, "c"},
+		{`"héllo"[5]`, Null},
+		{`"héllo"[-1]`, Null},
+		{`""[0]`, Null},
+		{`let café = "☕"; café`, "☕"},
 	}
 	runVmTests(t, tests)
 }
@@ -401,6 +586,68 @@ func TestRecursiveFunctions(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+// Far more iterations than there are frames, so these only pass if tail calls reuse the frame
+func TestTailCalls(t *testing.T) {
+	tests := []vmTestCase{
+		{`
+		let loop = funk(n, acc) { if (n == 0) { acc } else { loop(n - 1, acc + 1) } };
+		loop(1000000, 0)
+		`, 1000000},
+		{`
+		let loop = funk(n) { if (n == 0) { return "done"; } return loop(n - 1); };
+		loop(1000000)
+		`, "done"},
+		{`
+		let loop = funk(n) { (n == 0) ? 0 : loop(n - 1) };
+		loop(1000000)
+		`, 0},
+		// Both branches of if and ternary are in tail position
+		{`
+		let g = funk(n) { if (n > 0) { g(n - 1) } else { 0 } };
+		g(100000)
+		`, 0},
+		{`
+		let g = funk(n) { n > 0 ? g(n - 1) : 0 };
+		g(100000)
+		`, 0},
+		{`
+		let g = funk(n) { return n > 0 ? g(n - 1) : 0; };
+		g(100000)
+		`, 0},
+		{`
+		let g = funk(n) { if (n > 0) { n % 2 == 0 ? g(n - 1) : g(n - 1) } else { 7 } };
+		g(100000)
+		`, 7},
+		{`
+		let g = funk(n) { if (n > 0) { if (n > 1) { g(n - 1) } else { g(n - 1) } } else { 0 } };
+		g(100000)
+		`, 0},
+		// A call to another function swaps the function running in the frame
+		{`
+		let double = funk(n) { let a = n; let b = a * 2; b };
+		let next = funk(n) { double(n + 1) };
+		next(1)
+		`, 4},
+		// Closures keep their free variables
+		{`
+		let counter = funk(step) {
+			let count = funk(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + step) } };
+			count
+		};
+		counter(3)(100000, 0)
+		`, 300000},
+		// Builtins in tail position
+		{`let f = funk(a) { len(a) }; f([1, 2, 3])`, 3},
+		// Errors still reach a try block in a caller
+		{`
+		let f = funk(n) { if (n == 0) { error("bottom") } else { f(n - 1) } };
+		try { f(100000) } catch (e) { e["message"] }
+		`, "bottom"},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestRecursiveFibonacci(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -423,42 +670,46 @@ func TestRecursiveFibonacci(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+// Every case runs twice, without and with compiler optimizations,
+// since both must give the same results
 func runVmTests(t *testing.T, tests []vmTestCase) {
 	t.Helper()
 
 	for _, tt := range tests {
-		program := parse(tt.input)
+		for _, optimize := range []bool{false, true} {
+			program := parse(tt.input)
 
-		comp := compiler.New()
-		err := comp.Compile(program)
-		if err != nil {
-			t.Fatalf("compiler error: %s", err)
-		}
+			comp := compiler.New()
+			comp.Optimize = optimize
+			err := comp.Compile(program)
+			if err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
 
-		// Temp bytecode dumper
-		// for i, constant := range comp.Bytecode().Constants {
-		// 	fmt.Printf("CONSTANT %d %p (%T):\n", i, constant, constant)
-		//
-		// 	switch constant := constant.(type) {
-		// 	case *object.CompiledFunction:
-		// 		fmt.Printf(" Instructions:\n%s", constant.Instructions)
-		// 	case *object.Integer:
-		// 		fmt.Printf(" Value: %d\n", constant.Value)
-		// 	}
-		//
-		// 	fmt.Printf("\n")
-		// }
-		//
-		vm := New(comp.Bytecode())
+			// Temp bytecode dumper
+			// for i, constant := range comp.Bytecode().Constants {
+			// 	fmt.Printf("CONSTANT %d %p (%T):\n", i, constant, constant)
+			//
+			// 	switch constant := constant.(type) {
+			// 	case *object.CompiledFunction:
+			// 		fmt.Printf(" Instructions:\n%s", constant.Instructions)
+			// 	case *object.Integer:
+			// 		fmt.Printf(" Value: %d\n", constant.Value)
+			// 	}
+			//
+			// 	fmt.Printf("\n")
+			// }
+			//
+			vm := New(comp.Bytecode())
 
-		err = vm.Run()
-		if err != nil {
-			t.Fatalf("vm error: %s", err)
-		}
-
-		stackElem := vm.LastPoppedStackElement()
-		testExpectedObject(t, tt.expected, stackElem)
+			err = vm.Run()
+			if err != nil {
+				t.Fatalf("vm error (optimize=%t): %s", optimize, err)
+			}
 
+			stackElem := vm.LastPoppedStackElement()
+			testExpectedObject(t, tt.expected, stackElem)
+		}
 	}
 }
 
@@ -529,19 +780,65 @@ outer() + globalNum;
 	runVmTests(t, tests)
 }
 
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []vmTestCase{
+		{"let add = funk(a, b = 10) { a + b }; add(1);", 11},
+		{"let add = funk(a, b = 10) { a + b }; add(1, 2);", 3},
+		{"let f = funk(a, b = a * 2) { a + b }; f(3);", 9},
+		{"let f = funk(a = 1, b = 2, c = 3) { [a, b, c] }; f(10, 20);", []int{10, 20, 3}},
+		{"let n = 0; let f = funk(a = n) { a }; n = 5; f();", 5},
+		{"let f = funk(...rest) { rest }; f();", []int{}},
+		{"let f = funk(a, ...rest) { rest }; f(1, 2, 3);", []int{2, 3}},
+		{"let f = funk(a, b = 2, ...rest) { [a, b, len(rest)] }; f(1);", []int{1, 2, 0}},
+		{"let f = funk(a, b = 2, ...rest) { [a, b, len(rest)] }; f(1, 5, 6, 7);", []int{1, 5, 2}},
+		// Closures and tail calls set up their parameters the same way
+		{"let x = 5; let f = funk(a = x, ...rest) { a + len(rest) }; f();", 5},
+		{
+			`
+			let f = funk(n, ...rest) {
+				if (n == 0) { return rest; }
+				return f(n - 1, n, n);
+			};
+			f(3)
+			`,
+			[]int{1, 1},
+		},
+		{
+			`
+			let count = funk(n, total = 0) {
+				if (n == 0) { return total; }
+				return count(n - 1, total + 1);
+			};
+			count(10000)
+			`,
+			10000,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestCallFunctionsWithWrongArguments(t *testing.T) {
 	tests := []vmTestCase{
 		{
 			input:    `funk() { 1; }(1);`,
-			expected: `wrong number of arguments: want=0, got=1`,
+			expected: `1:14: wrong number of arguments. got=1, want=0`,
 		},
 		{
 			input:    `funk(a) { a; }();`,
-			expected: `wrong number of arguments: want=1, got=0`,
+			expected: `1:15: wrong number of arguments. got=0, want=1`,
 		},
 		{
 			input:    `funk(a, b) { a + b; }(1);`,
-			expected: `wrong number of arguments: want=2, got=1`,
+			expected: `1:22: wrong number of arguments. got=1, want=2`,
+		},
+		{
+			input:    `funk(a, b = 2) { a; }(1, 2, 3);`,
+			expected: `1:22: wrong number of arguments. got=3, want=1 to 2`,
+		},
+		{
+			input:    `funk(a, ...rest) { a; }();`,
+			expected: `1:24: wrong number of arguments. got=0, want at least 1`,
 		},
 	}
 
@@ -571,50 +868,553 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
-		{
-			`len(1)`,
-			&object.Error{
-				Message: "argument to `len` not supported, got INTEGER",
-			},
-		},
-		{
-			`len("one", "two")`,
-			&object.Error{
-				Message: "wrong number of arguments. got=2, want=1",
-			},
-		},
 		{`len([1, 2, 3])`, 3},
 		{`len([])`, 0},
+		{`len({"a": 1, "b": 2})`, 2},
 		{`puts("hello", "world!")`, Null},
 		{`first([1, 2, 3])`, 1},
 		{`first([])`, Null},
-		{
-			`first(1)`,
-			&object.Error{
-				Message: "argument to `first` must be ARRAY, got INTEGER",
-			},
-		},
 		{`last([1, 2, 3])`, 3},
 		{`last([])`, Null},
-		{
-			`last(1)`,
-			&object.Error{
-				Message: "argument to `last` must be ARRAY, got INTEGER",
-			},
-		},
 		{`rest([1, 2, 3])`, []int{2, 3}},
 		{`rest([])`, Null},
 		{`push([], 1)`, []int{1}},
+		{`keys({2: "b", 1: "a"})`, []int{1, 2}},
+		{`keys({})`, []int{}},
+	}
+	runVmTests(t, tests)
+}
+
+// A failed builtin call raises a runtime error instead of leaving an error value behind
+func TestBuiltinFunctionErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{`len(1)`, "1:4: argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "1:4: wrong number of arguments. got=2, want=1"},
+		{`keys([1])`, "1:5: argument to `keys` must be HASH, got ARRAY"},
+		{`first(1)`, "1:6: argument to `first` must be ARRAY, got INTEGER"},
+		{`last(1)`, "1:5: argument to `last` must be ARRAY, got INTEGER"},
+		{`push(1, 1)`, "1:5: argument to `push` must be ARRAY, got INTEGER"},
+		{`error("boom")`, "1:6: boom"},
+		{`error(1)`, "1:6: argument to `error` must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestWhileStatements(t *testing.T) {
+	tests := []vmTestCase{
+		// While loop that doesn't execute
+		{"while (false) { 1 } 2;", 2},
+		{"let y = 5; while (y > 10) { y } y;", 5},
+		// While loop with return statement, wrapped in a function since the main frame cannot return
+		{"let f = funk() { while (true) { return 3; } }; f();", 3},
+		{"let f = funk(n) { while (n > 0) { if (n == 2) { return n * 10; } return n; } }; f(2);", 20},
+		// While loop with break statement
+		{"while (true) { break; } 4;", 4},
+		// While loop with break in nested if
+		{"let i = 1; while (true) { if (i > 0) { if (i == 1) { break; } } } i;", 1},
+		// Simple while loop with counter
+		{"let i = 0; while (i < 3) { i = i + 1; } i;", 3},
+		// While loop with multiplication
+		{"let x = 1; while (x < 10) { x = x * 2; } x;", 16},
+		// While loop that doesn't execute
+		{"let y = 5; while (y > 10) { y = y + 1; } y;", 5},
+		// While loop with boolean condition
+		{"let flag = true; let count = 0; while (flag) { count = count + 1; if (count > 2) { flag = false; } } count;", 3},
+		// While loop with return statement, wrapped in a function since the main frame cannot return
+		{"let f = funk() { let i = 0; while (i < 5) { i = i + 1; if (i == 3) { return i; } }; i }; f();", 3},
+		// While loop with break statement
+		{"let i = 0; while (i < 10) { i = i + 1; if (i == 3) { break; } } i;", 3},
+		// While loop with continue statement
+		{"let i = 0; let sum = 0; while (i < 5) { i = i + 1; if (i == 3) { continue; } sum = sum + i; } sum;", 12},
+		// While loop with nested break
+		{"let i = 0; let found = false; while (i < 10) { i = i + 1; if (i > 5) { found = true; break; } } found;", true},
+		// While loop with break in nested if
+		{"let i = 0; while (true) { i = i + 1; if (i > 5) { if (i == 7) { break; } } } i;", 7},
+		// Local bindings inside a function
+		{"let f = funk(n) { let sum = 0; while (n > 0) { sum = sum + n; n = n - 1; } sum }; f(4);", 10},
+		// Functions and blocks ending with a loop that never runs or a let are null
+		{"let f = funk() { while (false) {} }; f();", Null},
+		{"let f = funk() { for (let i = 0; i < 0; i = i + 1) {} }; f();", Null},
+		{"let f = funk() { let x = 1; }; f();", Null},
+		{"if (true) { let x = 1; }", Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestForStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let f = funk() { for (let i = 3; i < 5; i + 1) { return i * 2; } }; f();", 6},
+		{"let f = funk() { for (let i = 9; i < 5; i + 1) { return 1; } 0 }; f();", 0},
+		{"for (let i = 0; i < 10; i + 1) { break; } 7;", 7},
+		{"let sum = 0; for (let i = 1; i < 5; i = i + 1) { sum = sum + i; } sum;", 10},
 		{
-			`push(1, 1)`,
-			&object.Error{
-				Message: "argument to `push` must be ARRAY, got INTEGER",
-			},
+			`let sum = 0;
+			for (let i = 0; i < 10; i = i + 1) {
+				if (i == 5) {
+					break;
+				}
+				sum = sum + i;
+			}
+			sum`,
+			10, // 0+1+2+3+4
+		},
+		{
+			`let sum = 0;
+			for (let i = 0; i < 5; i = i + 1) {
+				if (i == 2) {
+					continue;
+				}
+				sum = sum + i;
+			}
+			sum`,
+			8, // 0+1+3+4
+		},
+		{
+			`let f = funk() {
+				let result = 0;
+				for (let i = 0; i < 10; i = i + 1) {
+					result = result + i;
+					if (result > 10) {
+						return result;
+					}
+				}
+				result
+			};
+			f();`,
+			15, // 0+1+2+3+4+5
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestNestedLoops(t *testing.T) {
+	tests := []vmTestCase{
+		// Break only leaves the innermost loop
+		{"let f = funk() { while (true) { while (true) { break; } return 7; } }; f();", 7},
+		{
+			`let sum = 0;
+			for (let i = 1; i < 4; i = i + 1) {
+				for (let j = 1; j < 3; j = j + 1) {
+					sum = sum + (i * j);
+				}
+			}
+			sum`,
+			18, // (1*1 + 1*2) + (2*1 + 2*2) + (3*1 + 3*2) = 3 + 6 + 9 = 18
+		},
+		{
+			// Break and continue only affect the innermost loop
+			`let count = 0;
+			let i = 0;
+			while (i < 3) {
+				i = i + 1;
+				let j = 0;
+				while (true) {
+					j = j + 1;
+					if (j == 2) {
+						continue;
+					}
+					if (j > 3) {
+						break;
+					}
+					count = count + 1;
+				}
+			}
+			count`,
+			6,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestAssignmentExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		// Globals
+		{"let x = 5; x = 10; x;", 10},
+		{"let y = 3; y = y + 2; y;", 5},
+		{"let y = 1; let z = (y = 42); z", 42},
+		{"let x = 5; (x = 10) + 5;", 15},
+		{"let a = 1; let b = 2; a = b = 3; a + b;", 6},
+		{`let s = "hello"; s = "world"; s;`, "world"},
+		// Globals assigned from a function
+		{"let x = 1; let f = funk() { x = 2; }; f(); x;", 2},
+		// Locals
+		{"let f = funk() { let x = 1; x = x + 1; x }; f();", 2},
+		{"let f = funk(a) { a = a * 2; a }; f(4);", 8},
+		// Free variables
+		{"let f = funk() { let c = 0; let g = funk() { c = c + 1; }; g(); g() }; f();", 2},
+		// The enclosing function sees what its closures assign, and the other way round
+		{"let f = funk() { let c = 0; let g = funk() { c = c + 1; c }; g(); g(); c }; f();", 2},
+		{"let f = funk() { let c = 0; let g = funk() { c }; c = 5; g() }; f();", 5},
+		{"let f = funk() { let c = 1; let g = funk() { funk() { c = c * 10; } }; g()(); c }; f();", 10},
+		{"let f = funk(n) { let get = funk() { n }; let set = funk(v) { n = v; }; set(n + 1); get() }; f(1); f(7);", 8},
+		{
+			`let counter = funk() {
+				let count = 0;
+				funk() { count = count + 1; count };
+			};
+			let next = counter();
+			next();
+			next();
+			next();`,
+			3,
+		},
+		// Array and hash elements
+		{"let arr = [1, 2, 3]; arr[1] = 5; arr[1];", 5},
+		{"let arr = [1, 2, 3]; arr[0] = arr[1] = 7; arr[0] + arr[1];", 14},
+		{"let arr = [1, 2, 3]; arr[2] = 9; arr;", []int{1, 2, 9}},
+		{`let h = {"a": 1}; h["a"] = 2; h["a"];`, 2},
+		{`let h = {}; h["b"] = 3; h["b"];`, 3},
+		{"let f = funk(arr) { arr[0] = 10; }; let a = [1]; f(a); a[0];", 10},
+		// Compound assignment
+		{"let x = 5; x += 2; x;", 7},
+		{"let x = 5; x -= 2; x;", 3},
+		{"let x = 5; x *= 2; x;", 10},
+		{"let x = 10; x /= 2; x;", 5},
+		{"let x = 1.5; x += 1; x;", 2.5},
+		{`let s = "a"; s += "b"; s;`, "ab"},
+		{"let arr = [1, 2]; arr[1] += 3; arr[1];", 5},
+		{"let f = funk() { let x = 1; x += 41; x }; f();", 42},
+		// The target of a compound assignment is evaluated once
+		{"let n = 0; let f = funk() { n += 1; 0 }; let a = [10]; a[f()] += 1; n * 100 + a[0];", 111},
+		{"let n = 0; let a = [[5]]; let f = funk() { n += 1; a[0] }; f()[0] *= 2; n * 100 + a[0][0];", 110},
+		// Increment and decrement write back to elements, evaluating the target once
+		{"let a = [1, 2]; a[1]++; a[1];", 3},
+		{"let a = [1, 2]; a[0]++ + a[0];", 3},
+		{"let a = [5]; ++a[0];", 6},
+		{"let a = [5]; a[0]--; --a[0]; a[0];", 3},
+		{`let h = {"n": 1}; h["n"]++; h["n"];`, 2},
+		{"let n = 0; let f = funk() { n += 1; 0 }; let a = [10]; a[f()]++; n * 100 + a[0];", 111},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStructs(t *testing.T) {
+	tests := []vmTestCase{
+		{"struct Point { x, y }; Point { x: 1, y: 2 }.y", 2},
+		{"struct Point { x, y }; Point { y: 2 }.x", Null},
+		{"struct Point { x, y }; let p = Point { x: 1, y: 2 }; p.x = 5; p.x + p.y", 7},
+		{"struct Point { x, y }; let p = Point { x: 1 }; p.x += 2; p.x", 3},
+		{"struct Point { x }; let p = Point { x: 1 }; p.x++; p.x", 2},
+		{"struct Point { x }; let p = Point { x: 1 }; p.x-- * 10 + p.x", 10},
+		{"struct Point { x }; let p = Point { x: 1 }; ++p.x", 2},
+		{"struct Point { x, y }; let p = Point { x: 1 }; let n = 0; let f = funk() { n += 1; p }; f().x += 2; n * 10 + p.x", 13},
+		{"struct Point { x, y }; let p = Point { x: 1 }; (p.y = 4) + p.x", 5},
+		{"struct Counter { n }; let c = Counter { n: 0 }; let inc = funk(c) { c.n = c.n + 1 }; inc(c); inc(c); c.n", 2},
+		{"struct Box { inner }; struct Point { x }; let b = Box { inner: Point { x: 4 } }; b.inner.x", 4},
+		{"let f = funk() { struct Local { v }; Local { v: 3 } }; f().v", 3},
+		{"struct Point { x }; let f = funk(n) { Point { x: n } }; f(6).x", 6},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestTuples(t *testing.T) {
+	tests := []vmTestCase{
+		{"(1, 2, 3)[1]", 2},
+		{"(1, 2)[2]", Null},
+		{"len((1, 2, 3))", 3},
+		{"(4, 5).len()", 2},
+		{`(1, "a", true)[1]`, "a"},
+		{`let h = {(1, "a"): 5, (1, "b"): 6}; h[(1, "a")] + h[(1, "b")]`, 11},
+		{"let h = {(1, (2, 3)): 4}; h[(1, (2, 3))]", 4},
+		{"let h = {(1, 2): 4}; h[(2, 1)]", Null},
+		{"let divmod = funk(a, b) { return a / b, a % b; }; let (q, r) = divmod(7, 2); q * 10 + r", 31},
+		{"let f = funk() { let (a, b) = (1, 2); let (b, a) = (a, b); a - b }; f()", 1},
+		{"let f = funk(t) { let (a, b) = t; funk() { a * b } }; f((3, 4))()", 12},
+		{"let (x,) = (9,); x", 9},
+		// Tuples are compared element by element
+		{"(1, 2) == (1, 2)", true},
+		{"(1, 2) != (1, 2)", false},
+		{"(1, 2) == (2, 1)", false},
+		{"(1, 2) == (1, 2, 3)", false},
+		{`(1, "a", (true, 2.5)) == (1, "a", (true, 2.5))`, true},
+		{"(1, 2.0) == (1.0, 2)", true},
+		{`(1, "a") != ("a", 1)`, true},
+		{"let t = (1, 2); let (a, b) = t; (b, a) == (2, 1)", true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []vmTestCase{
+		{"let [a, b] = [1, 2]; a * 10 + b", 12},
+		{"let [a, b, ...rest] = [1, 2, 3, 4]; rest", []int{3, 4}},
+		{"let [a, ...rest] = [1]; len(rest)", 0},
+		{`let {name, age} = {"age": 28, "name": "Hong Anh", "club": "x"}; name`, "Hong Anh"},
+		{`let {age} = {"age": 28}; age`, 28},
+		{`let {n} = {"n": [].first()}; n`, Null},
+		{"let f = funk() { let [x, y] = [3, 4]; x * y }; f()", 12},
+		{"let f = funk([a, b]) { a - b }; f([5, 2])", 3},
+		{`let f = funk(n, {x, y}) { n + x + y }; f(1, {"x": 2, "y": 3})`, 6},
+		{"let f = funk([a, ...rest], b = len(rest)) { a + b }; f([1, 2, 3])", 3},
+		{"let f = funk((a, b), c) { a + b + c }; f((1, 2), 3)", 6},
+		{"let f = funk(t) { let (a, b) = t; funk([c]) { a + b + c } }; f((1, 2))([3])", 6},
+		{"let f = funk([a, b]) { if (a == 0) { return b; } f([a - 1, b + a]) }; f([4, 0])", 10},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestMethodCalls(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2, 3].len()", 3},
+		{`"héllo".len()`, 5},
+		{`{"a": 1}.len()`, 1},
+		{"let arr = [1, 2]; arr.push(3)", []int{1, 2, 3}},
+		{"let arr = [1, 2]; arr.push(3); arr", []int{1, 2}},
+		{"[1, 2, 3].rest().first()", 2},
+		{"2.power(10)", 1024},
+		{"let n = 3; n.power(2) + 1", 10},
+		{`{"b": 2, "a": 1}.keys().first()`, "a"},
+		{`{"b": 2, "a": 1}.keys().len()`, 2},
+		{"let last = [1, 2, 3].last; last()", 3},
+		{"[].first()", Null},
+		{"let f = funk(a) { return a.push(9).len(); }; f([1])", 2},
+		{"let f = funk(a) { return a.push(9); }; f([1])", []int{1, 9}},
+		{"let f = funk(a) { a.len() + [a].len() }; f([5, 6])", 3},
+		// A function in a field of a struct is called without a receiver
+		{"struct S { f }; let s = S { f: funk(x) { x * 2 } }; s.f(4)", 8},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestIncrementDecrementWriteBack(t *testing.T) {
+	tests := []vmTestCase{
+		{"let x = 5; x++;", 5},
+		{"let x = 5; x++; x;", 6},
+		{"let x = 5; ++x;", 6},
+		{"let x = 5; ++x; x;", 6},
+		{"let x = 5; x--; x;", 4},
+		{"let x = 5; --x;", 4},
+		{"let f = funk() { let i = 0; i++; i++; i }; f();", 2},
+		{"let x = 5; let f = funk() { x++; }; f(); x;", 6},
+		{"let count = 0; for (let i = 0; i < 10; i++) { count++; } count", 10},
+		{
+			`let count = 0;
+			for (let i = 0; i < 3; i++) {
+				for (let j = 0; j < 2; j++) {
+					count++;
+				}
+			}
+			count`,
+			6,
 		},
 	}
+
 	runVmTests(t, tests)
 }
 
+func TestIncrementDecrementErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{"5++;", "1:2: cannot increment non-identifier: INTEGER"},
+		{"--5;", "1:1: cannot increment non-identifier: INTEGER"},
+		{"let x = 1; 2.5--;", "1:15: cannot increment non-identifier: FLOAT"},
+		{"let x = 1; ++(x + 1);", "1:12: cannot increment non-identifier: (x + 1)"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err == nil {
+			t.Fatalf("expected compiler error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong compiler error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestAssignmentErrors(t *testing.T) {
+	compileErrors := []vmTestCase{
+		{"x = 5;", "1:1: undefined variable x"},
+		{"5 = 10;", "1:1: cannot assign to 5"},
+		{"let a = 1; let b = 2; (true ? a : b) = 3;", "1:29: cannot assign to (true ? a : b)"},
+		{"len = 5;", "1:1: cannot assign to len"},
+		{"let f = funk() { f = 1; };", "1:18: cannot assign to f"},
+	}
+
+	for _, tt := range compileErrors {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err == nil {
+			t.Fatalf("expected compiler error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong compiler error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+
+	runtimeErrors := []vmTestCase{
+		{"let arr = [1]; arr[1] = 2;", "1:23: index out of range: 1"},
+		{"let x = 5; x[0] = 1;", "1:17: index assignment not supported: INTEGER"},
+		{`let arr = [1]; arr["a"] = 2;`, "1:25: array index must be INTEGER, got STRING"},
+		{"struct P { x }; let p = P {}; p.y = 1;", "1:35: struct P has no field y"},
+		{"let n = 1; n.x = 2;", "1:16: field access not supported: INTEGER"},
+	}
+
+	for _, tt := range runtimeErrors {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestMacros(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`let infixExpression = macro() { quote(1 + 2); };
+			infixExpression();`,
+			3,
+		},
+		{
+			`let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); };
+			reverse(2 + 2, 10 - 5);`,
+			1,
+		},
+		{
+			`let unless = macro(condition, consequence, alternative) {
+				quote(if (!(unquote(condition))) {
+					unquote(consequence);
+				} else {
+					unquote(alternative);
+				});
+			};
+			unless(10 > 5, "not greater", "greater");`,
+			"greater",
+		},
+		{
+			// Macro calls nested in other expressions and statements are expanded too
+			`let double = macro(x) { quote(unquote(x) * 2); };
+			let sum = 0;
+			for (let i = 0; i < 3; i++) { sum += double(i); }
+			sum;`,
+			6,
+		},
+		{
+			`let double = macro(x) { quote(unquote(x) * 2); };
+			let f = funk(a) { double(a) + 1 };
+			f(double(5));`,
+			21,
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		expanded, err := evaluator.ExpandProgram(program, object.NewEnvironment())
+		if err != nil {
+			t.Fatalf("macro expansion error: %s", err)
+		}
+
+		comp := compiler.New()
+		err = comp.Compile(expanded)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElement())
+	}
+}
+
+// Macros defined in one program must still be expandable in the next one,
+// the way the REPL compiles line after line
+func TestMacrosAcrossPrograms(t *testing.T) {
+	inputs := []string{
+		`let square = macro(x) { quote(unquote(x) * unquote(x)); };`,
+		`let n = 4;`,
+		`square(n + 1);`,
+	}
+
+	macroEnv := object.NewEnvironment()
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+	constants := []object.Object{}
+	globals := make([]object.Object, GlobalSize)
+
+	var vm *VM
+	for _, input := range inputs {
+		expanded, err := evaluator.ExpandProgram(parse(input), macroEnv)
+		if err != nil {
+			t.Fatalf("macro expansion error: %s", err)
+		}
+
+		comp := compiler.NewWithState(symbolTable, constants)
+		err = comp.Compile(expanded)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := comp.Bytecode()
+		constants = bytecode.Constants
+
+		vm = NewWithGlobalStore(bytecode, globals)
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+	}
+
+	// (n + 1) * (n + 1)
+	testExpectedObject(t, 25, vm.LastPoppedStackElement())
+}
+
+func TestMacroExpansionErrors(t *testing.T) {
+	input := `let bad = macro() { 1 }; bad();`
+
+	_, err := evaluator.ExpandProgram(parse(input), object.NewEnvironment())
+	if err == nil {
+		t.Fatalf("expected macro expansion error but resulted in none.")
+	}
+
+	expected := "macro expansion failed: we only support returning AST-nodes from macros"
+	if err.Error() != expected {
+		t.Errorf("wrong error: want=%q, got=%q", expected, err)
+	}
+}
+
 func testExpectedObject(t *testing.T, expected any, actual object.Object) {
 	t.Helper()
 
@@ -624,6 +1424,11 @@ func testExpectedObject(t *testing.T, expected any, actual object.Object) {
 		if err != nil {
 			t.Errorf("testIntegerObject failed: %s", err)
 		}
+	case float64:
+		err := testFloatObject(expected, actual)
+		if err != nil {
+			t.Errorf("testFloatObject failed: %s", err)
+		}
 	case bool:
 		err := testBooleanObject(bool(expected), actual)
 		if err != nil {
@@ -722,6 +1527,19 @@ func testIntegerObject(expected int64, actual object.Object) error {
 	return nil
 }
 
+func testFloatObject(expected float64, actual object.Object) error {
+	result, ok := actual.(*object.Float)
+	if !ok {
+		return fmt.Errorf("object is not Float. got: %T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got: %f, want: %f", result.Value, expected)
+	}
+
+	return nil
+}
+
 func testBooleanObject(expected bool, actual object.Object) error {
 	result, ok := actual.(*object.Boolean)
 	if !ok {
@@ -734,3 +1552,389 @@ func testBooleanObject(expected bool, actual object.Object) error {
 	}
 	return nil
 }
+
+func TestRuntimeErrorPositions(t *testing.T) {
+	input := `let divide = funk(a, b) {
+	a / b
+};
+let arr = [1, 2];
+divide(1.0, 0.0) + arr[0];`
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err == nil {
+		t.Fatalf("expected VM error but resulted in none.")
+	}
+
+	// The error points into the body of the function, not at the call site
+	expected := "2:4: division by zero"
+	if err.Error() != expected {
+		t.Errorf("wrong VM error: want=%q, got=%q", expected, err)
+	}
+
+	runtimeErr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("error is not *RuntimeError. got=%T", err)
+	}
+	if runtimeErr.Message != "division by zero" {
+		t.Errorf("wrong message: want=%q, got=%q", "division by zero", runtimeErr.Message)
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{"1 / 0", "1:3: division by zero"},
+		{"let f = funk(a, b) { a / b }; f(10, 0)", "1:24: division by zero"},
+		{"1 << -1", "1:3: negative shift count: -1"},
+		{"struct P { x }; P { y: 1 }", "1:19: struct P has no field y"},
+		{"struct P { x }; P { x: 1 }.y", "1:27: struct P has no field y"},
+		{"let h = {}; h.x", "1:14: HASH has no method x"},
+		{`"abc".push(1)`, "1:6: STRING has no method push"},
+		{"[1].push()", "1:9: wrong number of arguments. got=1, want=2"},
+		{"let P = 5; P { x: 1 }", "1:14: not a struct type: INTEGER"},
+		{"let (a, b) = (1, 2, 3);", "1:5: wrong number of values to destructure: want=2, got=3"},
+		{"let (a, b) = [1, 2];", "1:5: cannot destructure ARRAY as a tuple"},
+		{"let [a, b] = [1];", "1:5: wrong number of values to destructure: want=2, got=1"},
+		{"let [a, b, ...rest] = [1];", "1:5: wrong number of values to destructure: want at least 2, got=1"},
+		{`let {name, age} = {"name": "a"};`, `1:5: no key "age" in the hash to destructure`},
+		{"let {name} = [1];", "1:5: cannot destructure ARRAY as a hash"},
+		{"let f = funk(x, [a, b]) { a }; f(0, [1, 2, 3])", "1:17: wrong number of values to destructure: want=2, got=3"},
+		{"{(1, [2]): 3}", "1:1: unusable as hash key: TUPLE"},
+		{"8 >> -2", "1:3: negative shift count: -2"},
+		{"let f = funk() { 1 + f() }; f()", "1:23: call stack overflow: more than 1024 nested calls"},
+		{"let f = funk(a, b, c, d, e) { 1 + f(a, b, c, d, e) }; f(1, 2, 3, 4, 5)", "1:46: stack overflow"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestStackTrace(t *testing.T) {
+	input := `let divide = funk(a, b) {
+	a / b
+};
+let half = funk(x) { divide(x, 0) + 1 };
+half(4);`
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	runtimeErr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("error is not *RuntimeError. got=%T (%v)", err, err)
+	}
+
+	expected := []string{"divide 2:4", "half 4:28", "<main> 5:5"}
+	if len(runtimeErr.Trace) != len(expected) {
+		t.Fatalf("wrong trace length: want=%d, got=%d (%+v)",
+			len(expected), len(runtimeErr.Trace), runtimeErr.Trace)
+	}
+	for i, entry := range runtimeErr.Trace {
+		got := entry.Function + " " + entry.Pos.String()
+		if got != expected[i] {
+			t.Errorf("wrong trace entry %d: want=%q, got=%q", i, expected[i], got)
+		}
+	}
+
+	expectedTrace := "stack trace:\n\tat divide (2:4)\n\tat half (4:28)\n\tat <main> (5:5)"
+	if runtimeErr.StackTrace() != expectedTrace {
+		t.Errorf("wrong stack trace:\nwant=%q\ngot=%q", expectedTrace, runtimeErr.StackTrace())
+	}
+}
+
+func TestStackTraceDeepRecursion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			// The recursive calls all come from the same place
+			"let f = funk(n) { if (n == 0) { 1 / 0 } else { f(n - 1) + 1 } }; f(500);",
+			"stack trace:\n\tat f (1:35)\n\tat f (1:49)\n\t... repeated 499 more times\n\tat <main> (1:67)",
+		},
+		{
+			// Calls alternating between two places do not repeat, so the trace is cut off
+			"let f = funk(n) { if (n == 0) { 1 / 0 } else { n % 2 == 0 ? f(n - 1) + 1 : f(n - 1) + 2 } }; f(100);",
+			"stack trace:\n\tat f (1:35)" + strings.Repeat("\n\tat f (1:77)\n\tat f (1:62)", 24) + "\n\tat f (1:77)\n\t... 52 more calls",
+		},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		runtimeErr, ok := err.(*RuntimeError)
+		if !ok {
+			t.Fatalf("error is not *RuntimeError. got=%T (%v)", err, err)
+		}
+
+		if runtimeErr.StackTrace() != tt.expected {
+			t.Errorf("wrong stack trace:\nwant=%q\ngot=%q", tt.expected, runtimeErr.StackTrace())
+		}
+	}
+}
+
+func TestTopLevelReturn(t *testing.T) {
+	tests := []vmTestCase{
+		{"return 10; 9;", 10},
+		{"let x = 5; if (x > 1) { return x * 2; } x", 10},
+		{"let x = 0; if (x > 1) { return x * 2; } x", 0},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []vmTestCase{
+		{`try { 1 } catch (e) { 2 }`, 1},
+		{`try { 1 / 0 } catch (e) { 2 }`, 2},
+		{`try { 1 / 0 } catch (e) { e["message"] }`, "division by zero"},
+		{`try { error("boom") } catch (e) { e["message"] }`, "boom"},
+		{`try { len(1) } catch (e) { e["message"] }`, "argument to `len` not supported, got INTEGER"},
+		{`try { [1, 2][0] + "a" } catch (e) { e["message"] }`, "unsupported types for binary operation: INTEGER STRING"},
+		{`try { let x = 1; } catch (e) { 2 }`, Null},
+		{`try { 1 / 0 } catch (e) { }`, Null},
+		// The value of a try expression can be used like any other
+		{`let x = try { error("a") } catch (e) { 5 }; x * 2`, 10},
+		{`1 + try { 2 } catch (e) { 3 } + 4`, 7},
+		// Errors unwind through function calls
+		{`
+		let divide = funk(a, b) { a / b };
+		let safeDivide = funk(a, b) {
+			try { divide(a, b) } catch (e) { 0 }
+		};
+		[safeDivide(6, 3), safeDivide(1, 0)]
+		`, []int{2, 0}},
+		{`
+		let f = funk() { error("deep") };
+		let g = funk() { f() };
+		try { g() } catch (e) { e["message"] }
+		`, "deep"},
+		// Nested try blocks, the innermost one catches first
+		{`
+		try {
+			try { error("inner") } catch (e) { error(e["message"] + " again") }
+		} catch (e) {
+			e["message"]
+		}
+		`, "inner again"},
+		{`
+		let r = try { try { 1 } catch (e) { 2 }; error("outer") } catch (e) { e["message"] };
+		r
+		`, "outer"},
+		// Returning from inside a try block removes its handler
+		{`
+		let f = funk() { try { return 1; } catch (e) { 2 } };
+		let g = funk() { f(); error("after") };
+		try { g() } catch (e) { e["message"] }
+		`, "after"},
+		{`
+		let f = funk(x) { try { if (x > 0) { return x; } error("neg") } catch (e) { 0 } };
+		[f(1), f(-1)]
+		`, []int{1, 0}},
+		// break and continue inside a try block
+		{`
+		let sum = 0;
+		for (let i = 0; i < 5; i++) {
+			try {
+				if (i == 1) { continue; }
+				if (i == 3) { break; }
+				sum = sum + i;
+			} catch (e) { }
+		}
+		sum
+		`, 2},
+		{`
+		let sum = 0;
+		while (sum < 10) {
+			try { break; } catch (e) { }
+		}
+		try { error("x") } catch (e) { sum + 1 }
+		`, 1},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestUncaughtErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{`try { 1 } catch (e) { 2 }; error("later")`, "1:33: later"},
+		{`try { error("a") } catch (e) { error("b") }`, "1:37: b"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestOptimizedBytecode(t *testing.T) {
+	tests := []string{
+		"1 + 2 * 3 - 4 / 2",
+		"(10 % 4) << 3 | 1 & 5 ^ 7",
+		"-(3 + 4) * ~2",
+		"1.5 + 2 * 0.25 - 1 / 3.0",
+		"0.1 + 0.2 == 0.3",
+		"2 <= 2.0 && 3 >= 4 || !false",
+		`"s" + "8" == "s8"`,
+		`true == !false != (1 < 2)`,
+		`!"a" || !0`,
+		"1 / 0",
+		"1.5 % 0",
+		"1 << -2",
+		`"a" - "b"`,
+		"1 + true",
+		`"a" == 1`,
+		`-"a"`,
+		"let x = 2; x * (3 + 4) + (1 + 1)",
+		"let f = funk(x) { return x * 2; x + 1; 99 }; f(5)",
+		"let f = funk(x) { if (x > 1) { return 1; 2 } else { return 3 } }; [f(2), f(0)]",
+		"let i = 0; while (true) { i++; if (i > 3) { break; i = 100; } } i",
+		"let s = 0; for (let i = 0; i < 5; i++) { if (i % 2 == 0) { continue; s = 100; } s += i; } s",
+		"let f = funk(a, b) { if (a) { if (b) { 1 } else { 2 } } else { 3 } }; [f(true, true), f(true, false), f(false, true)]",
+		`let h = {"a" + "b": 1 + 1}; h["ab"]`,
+		`[1, 1, 1, "a", "a", 2.5, 2.5][6]`,
+		"try { 1 / (2 - 2) } catch (e) { e[\"message\"] }",
+		"return 1 + 1; 5",
+	}
+
+	for _, input := range tests {
+		expected, expectedErr := runWithOptimize(t, input, false)
+		actual, actualErr := runWithOptimize(t, input, true)
+
+		if expectedErr != actualErr {
+			t.Errorf("%q: errors differ. unoptimized=%q, optimized=%q", input, expectedErr, actualErr)
+		}
+		if expected != actual {
+			t.Errorf("%q: results differ. unoptimized=%q, optimized=%q", input, expected, actual)
+		}
+	}
+}
+
+// Run a program and return its result, or the error it raised
+func runWithOptimize(t *testing.T, input string, optimize bool) (string, string) {
+	t.Helper()
+
+	comp := compiler.New()
+	comp.Optimize = optimize
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err != nil {
+		return "", err.Error()
+	}
+
+	return vm.LastPoppedStackElement().Inspect(), ""
+}
+
+// Programs for the benchmarks, small enough for many iterations
+var benchmarks = []struct {
+	name  string
+	input string
+}{
+	// What benchmark/main.go times, with a smaller argument
+	{"fibonacci", `
+	let fibonacci = funk(x) {
+		if (x == 0) {
+			0
+		} else {
+			if (x == 1) {
+				return 1;
+			} else {
+				fibonacci(x - 1) + fibonacci(x - 2);
+			}
+		}
+	}
+	fibonacci(25);
+	`},
+	{"loop", `
+	let sum = 0;
+	for (let i = 0; i < 100000; i++) {
+		sum = sum + i % 7;
+	}
+	sum
+	`},
+	{"strings", `
+	let text = "the quick brown fox jumps over the lazy dog";
+	let copy = "";
+	for (let i = 0; i < len(text); i++) {
+		copy = copy + text[i];
+	}
+	copy
+	`},
+}
+
+func BenchmarkPrograms(b *testing.B) {
+	for _, bm := range benchmarks {
+		for _, optimize := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%s/optimize=%t", bm.name, optimize), func(b *testing.B) {
+				comp := compiler.New()
+				comp.Optimize = optimize
+				err := comp.Compile(parse(bm.input))
+				if err != nil {
+					b.Fatalf("compiler error: %s", err)
+				}
+				bytecode := comp.Bytecode()
+
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					vm := New(bytecode)
+					err := vm.Run()
+					if err != nil {
+						b.Fatalf("vm error: %s", err)
+					}
+				}
+			})
+		}
+	}
+}